@@ -0,0 +1,237 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"strings"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// AllDocsQuery is a query on the _all_docs index.
+type AllDocsQuery struct {
+	Keys        []string `json:"keys,omitempty"`
+	StartKey    string   `json:"startkey,omitempty"`
+	EndKey      string   `json:"endkey,omitempty"`
+	Limit       int      `json:"limit,omitempty"`
+	Skip        int      `json:"skip,omitempty"`
+	Descending  bool     `json:"descending,omitempty"`
+	IncludeDocs bool     `json:"include_docs,omitempty"`
+	// Fields, with IncludeDocs, trims the documents to the given fields.
+	// _all_docs has no projection, so full documents are still transferred
+	// and trimmed once received, which only saves memory.
+	Fields []string `json:"-"`
+}
+
+// DocRow is a row of the _all_docs index.
+type DocRow struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Value struct {
+		Rev     string `json:"rev"`
+		Deleted bool   `json:"deleted"`
+	} `json:"value"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// AllDocsMultiQuery runs several queries on the _all_docs index in a single
+// request, and returns the rows of each query in the order of queries.
+func (db *DB) AllDocsMultiQuery(queries []AllDocsQuery) ([][]DocRow, error) {
+	var data struct {
+		Results []struct {
+			Rows []DocRow `json:"rows"`
+		} `json:"results"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_all_docs/queries").
+		Send(map[string]interface{}{"queries": queries})
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	rows := make([][]DocRow, len(data.Results))
+	for i, result := range data.Results {
+		rows[i] = result.Rows
+		if i >= len(queries) || queries[i].Fields == nil {
+			continue
+		}
+		for j := range rows[i] {
+			doc, err := ProjectFields(rows[i][j].Doc, queries[i].Fields)
+			if err != nil {
+				return nil, err
+			}
+			rows[i][j].Doc = doc
+		}
+	}
+	return rows, nil
+}
+
+// ProjectFields returns doc with only the given fields, each a field name
+// or a dot separated path. Missing fields are left out. An empty or null
+// doc is returned as is.
+func ProjectFields(doc json.RawMessage, fields []string) (json.RawMessage, error) {
+	if len(doc) == 0 || string(doc) == "null" {
+		return doc, nil
+	}
+	fieldsIn, err := toMap(doc)
+	if err != nil {
+		return nil, err
+	}
+	projected := make(map[string]interface{})
+	for _, field := range fields {
+		v, ok := lookupPath(fieldsIn, field)
+		if !ok {
+			continue
+		}
+		m := projected
+		names := strings.Split(field, ".")
+		for _, name := range names[:len(names)-1] {
+			sub, ok := m[name].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[name] = sub
+			}
+			m = sub
+		}
+		m[names[len(names)-1]] = v
+	}
+	return json.Marshal(projected)
+}
+
+// AllDocsByKeys returns the rows of the _all_docs index for the given
+// document ids, in order, with the winning revision of each document. The
+// rows of missing documents have an Error of "not_found" and an empty ID.
+func (db *DB) AllDocsByKeys(keys []string, includeDocs bool) ([]DocRow, error) {
+	var data struct {
+		Rows []DocRow `json:"rows"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_all_docs")
+	if includeDocs {
+		req.Param("include_docs", "true")
+	}
+	req.Send(map[string]interface{}{"keys": keys})
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	return data.Rows, nil
+}
+
+// GetRevs returns the winning revision of each of the given documents,
+// by id, in a single request. Missing and deleted documents are left out.
+func (db *DB) GetRevs(ids []string) (map[string]string, error) {
+	rows, err := db.AllDocsByKeys(ids, false)
+	if err != nil {
+		return nil, err
+	}
+	revs := make(map[string]string, len(rows))
+	for _, row := range rows {
+		if row.Error == "" && !row.Value.Deleted {
+			revs[row.ID] = row.Value.Rev
+		}
+	}
+	return revs, nil
+}
+
+// AllDocsInPartition returns the rows of the _all_docs index of a partition
+// of a partitioned database. opts accepts the same options as
+// GetAllDocument, such as include_docs and key ranges.
+func (db *DB) AllDocsInPartition(partitionKey string, opts Options) ([]DocRow, error) {
+	return db.allDocs("/_partition/"+partitionKey+"/_all_docs", opts)
+}
+
+// AllLocalDocs returns the ids of the _local documents of the database,
+// such as replication checkpoints, which _all_docs leaves out.
+func (db *DB) AllLocalDocs() ([]string, error) {
+	rows, err := db.LocalDocs(Options{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ids, nil
+}
+
+// LocalDocs returns the rows of the _local_docs index. opts accepts the
+// same options as GetAllDocument, such as include_docs and key ranges.
+func (db *DB) LocalDocs(opts Options) ([]DocRow, error) {
+	return db.allDocs("/_local_docs", opts)
+}
+
+// allDocs returns the rows of the _all_docs index at path.
+func (db *DB) allDocs(path string, opts Options) ([]DocRow, error) {
+	var data struct {
+		Rows []DocRow `json:"rows"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + path)
+	if err := setOptions(req, opts); err != nil {
+		return nil, err
+	}
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	return data.Rows, nil
+}
+
+// Truncate deletes all the documents of the database, and returns the
+// number of documents deleted. Design documents are kept if keepDesignDocs
+// is true. Documents that could not be deleted are reported in a
+// *BulkError.
+func (db *DB) Truncate(keepDesignDocs bool) (int, error) {
+	// Document ids are sorted by raw collation in _all_docs, so the design
+	// documents are those between "_design/" and "_design0".
+	ranges := []Options{{}}
+	if keepDesignDocs {
+		ranges = []Options{
+			{"endkey": "_design/", "inclusive_end": false},
+			{"startkey": "_design0"},
+		}
+	}
+	deleted := 0
+	for _, opts := range ranges {
+		opts["limit"] = queryPageSize
+		for {
+			// Deleted documents leave the index, so each page starts over
+			// from the beginning of the range.
+			rows, err := db.allDocs("/_all_docs", opts)
+			if err != nil {
+				return deleted, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+			tombstones := make([]interface{}, len(rows))
+			for i, row := range rows {
+				tombstones[i] = map[string]interface{}{
+					"_id":      row.ID,
+					"_rev":     row.Value.Rev,
+					"_deleted": true,
+				}
+			}
+			results, err := db.bulkDocs(tombstones)
+			if err != nil {
+				return deleted, err
+			}
+			bulkErr := &BulkError{}
+			for _, result := range results {
+				if result.Error != "" {
+					bulkErr.Docs = append(bulkErr.Docs, DocError{result.ID, result.Error, result.Reason})
+					continue
+				}
+				deleted++
+			}
+			if len(bulkErr.Docs) > 0 {
+				return deleted, bulkErr
+			}
+			if len(rows) < queryPageSize {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
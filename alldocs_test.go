@@ -0,0 +1,20 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectFields(t *testing.T) {
+	t.Log("Testing document projection")
+	doc := json.RawMessage(`{"_id":"a","name":"x","count":12345678901234567890,"owner":{"email":"e","age":3}}`)
+	projected, err := ProjectFields(doc, []string{"_id", "count", "owner.email", "missing"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"_id":"a","count":12345678901234567890,"owner":{"email":"e"}}`, string(projected))
+
+	projected, err = ProjectFields(json.RawMessage("null"), []string{"name"})
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(projected))
+}
@@ -0,0 +1,361 @@
+package cloudant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// AttachInline adds an attachment to doc, so that it is written together
+// with the document in a single request by CreateDocument or
+// UpdateDocument. It is meant for small attachments, since the data is
+// base64 encoded into the document body.
+func AttachInline(doc map[string]interface{}, name, contentType string, data []byte) {
+	attachments, ok := doc["_attachments"].(map[string]interface{})
+	if !ok {
+		attachments = make(map[string]interface{})
+		doc["_attachments"] = attachments
+	}
+	attachments[name] = map[string]interface{}{
+		"content_type": contentType,
+		"data":         base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+// CreateDocumentWithAttachment writes doc and an attachment read from r,
+// without base64 encoding the data. The document id is taken from its _id
+// field, or generated if missing. When r reports its size (as
+// *bytes.Reader, *strings.Reader and io.Seekers do), both are written in a
+// single multipart/related request. Otherwise the document is created
+// first, and the attachment is then streamed with chunked transfer
+// encoding; if that fails, the document is left without the attachment.
+// Either way, the attachment is never held in memory.
+// Cloudant doc: https://docs.cloudant.com/attachments.html
+func (db *DB) CreateDocumentWithAttachment(doc interface{}, name, contentType string, r io.Reader) (id, rev string, err error) {
+	if doc, err = db.marshal(doc); err != nil {
+		return "", "", err
+	}
+	fields, err := toMap(doc)
+	if err != nil {
+		return "", "", err
+	}
+	id, _ = fields["_id"].(string)
+	if id == "" {
+		if id, err = newUUID(); err != nil {
+			return "", "", err
+		}
+		fields["_id"] = id
+	}
+	length, err := readerLen(r)
+	if err != nil {
+		return "", "", err
+	}
+	if length < 0 {
+		docJSON, err := json.Marshal(fields)
+		if err != nil {
+			return "", "", err
+		}
+		if rev, err = db.PutRaw(id, docJSON); err != nil {
+			return "", "", err
+		}
+		req, err := http.NewRequest("PUT", db.path+"/"+docPath(id)+"/"+url.PathEscape(name)+"?rev="+url.QueryEscape(rev), r)
+		if err != nil {
+			return "", "", err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return db.sendWrite(req)
+	}
+	fields["_attachments"] = map[string]interface{}{
+		name: map[string]interface{}{
+			"follows":      true,
+			"content_type": contentType,
+			"length":       length,
+		},
+	}
+	docJSON, err := json.Marshal(fields)
+	if err != nil {
+		return "", "", err
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json"}})
+		if err == nil {
+			_, err = part.Write(docJSON)
+		}
+		if err == nil {
+			part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+		}
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("PUT", db.path+"/"+docPath(id), pr)
+	if err != nil {
+		pr.Close()
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", `multipart/related; boundary="`+mw.Boundary()+`"`)
+	id, rev, err = db.sendWrite(req)
+	pr.Close()
+	return id, rev, err
+}
+
+// sendWrite sends a request writing a document, and returns the id and new
+// revision of the document.
+func (db *DB) sendWrite(req *http.Request) (id, rev string, err error) {
+	req.SetBasicAuth(db.username, db.password)
+	resp, err := db.client.httpClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if err := responseError(resp, body); err != nil {
+		return "", "", err
+	}
+	var data struct {
+		ID  string `json:"id"`
+		Rev string `json:"rev"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", "", err
+	}
+	return data.ID, data.Rev, nil
+}
+
+// ByteRange is an inclusive range of bytes. A negative End means up to the
+// last byte.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// AttachmentData is the content of an attachment, along with the response
+// headers needed to serve it.
+type AttachmentData struct {
+	// Body is the content of the attachment, and must be closed.
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	// ContentRange is the range returned, for partial content.
+	ContentRange string
+	// AcceptRanges is "bytes" if the server supports range requests.
+	AcceptRanges string
+	// Partial is true if only a range of the attachment was returned.
+	Partial bool
+}
+
+// GetAttachment returns the content of an attachment. If rng is not nil,
+// only that range of bytes is requested, which lets large attachments such
+// as videos be served with seeking.
+func (db *DB) GetAttachment(docID, name string, rng *ByteRange) (*AttachmentData, error) {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/" + docPath(docID) + "/" + url.PathEscape(name))
+	if rng != nil {
+		end := ""
+		if rng.End >= 0 {
+			end = strconv.FormatInt(rng.End, 10)
+		}
+		req.Set("Range", "bytes="+strconv.FormatInt(rng.Start, 10)+"-"+end)
+	}
+	resp, err := db.client.stream(req)
+	if err != nil {
+		return nil, err
+	}
+	return &AttachmentData{
+		Body:          resp.Body,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		ContentRange:  resp.Header.Get("Content-Range"),
+		AcceptRanges:  resp.Header.Get("Accept-Ranges"),
+		Partial:       resp.StatusCode == http.StatusPartialContent,
+	}, nil
+}
+
+// AttachmentRef identifies an attachment of a document.
+type AttachmentRef struct {
+	DocID string
+	Name  string
+}
+
+// GetAttachments downloads the content of many attachments, running up to
+// concurrency requests at once. Attachments that could not be downloaded
+// are left out of the result, and reported in an *AttachmentsError.
+func (db *DB) GetAttachments(refs []AttachmentRef, concurrency int) (map[AttachmentRef][]byte, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[AttachmentRef][]byte, len(refs))
+	errs := make(map[AttachmentRef]error)
+	sem := make(chan struct{}, concurrency)
+	for _, ref := range refs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ref AttachmentRef) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			data, err := db.readAttachment(ref)
+			mu.Lock()
+			if err != nil {
+				errs[ref] = err
+			} else {
+				results[ref] = data
+			}
+			mu.Unlock()
+		}(ref)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return results, &AttachmentsError{errs}
+	}
+	return results, nil
+}
+
+// readAttachment returns the full content of an attachment.
+func (db *DB) readAttachment(ref AttachmentRef) ([]byte, error) {
+	att, err := db.GetAttachment(ref.DocID, ref.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer att.Body.Close()
+	return ioutil.ReadAll(att.Body)
+}
+
+// AttachmentInfo describes an attachment from the stub held by its
+// document.
+type AttachmentInfo struct {
+	Name        string `json:"-"`
+	ContentType string `json:"content_type"`
+	Length      int64  `json:"length"`
+	Digest      string `json:"digest"`
+	RevPos      int    `json:"revpos"`
+	// Encoding is the compression used to store the attachment, if any,
+	// and EncodedLength its compressed size.
+	Encoding      string `json:"encoding,omitempty"`
+	EncodedLength int64  `json:"encoded_length,omitempty"`
+}
+
+// ListAttachments returns the attachments of a document, sorted by name.
+// Only the stubs held by the document are read, so no attachment content
+// is transferred.
+func (db *DB) ListAttachments(docID string) ([]AttachmentInfo, error) {
+	var doc struct {
+		Attachments map[string]AttachmentInfo `json:"_attachments"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path+"/"+docPath(docID)).
+		Param("att_encoding_info", "true")
+	if err := db.client.end(req, &doc); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(doc.Attachments))
+	for name := range doc.Attachments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := make([]AttachmentInfo, len(names))
+	for i, name := range names {
+		infos[i] = doc.Attachments[name]
+		infos[i].Name = name
+	}
+	return infos, nil
+}
+
+// toMap converts doc to its JSON object representation.
+func toMap(doc interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// docFields converts doc to its JSON object representation, honoring
+// WithJSON.
+func (db *DB) docFields(doc interface{}) (map[string]interface{}, error) {
+	doc, err := db.marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	if db.client.jsonUnmarshal == nil {
+		return toMap(doc)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := db.unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// newUUID returns a random document id in the format used by CouchDB.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readerLen returns the number of bytes left in r, or -1 if r doesn't
+// report its size.
+func readerLen(r io.Reader) (int64, error) {
+	switch v := r.(type) {
+	case interface {
+		Len() int
+	}:
+		return int64(v.Len()), nil
+	case io.Seeker:
+		cur, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := v.Seek(cur, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return end - cur, nil
+	}
+	return -1, nil
+}
@@ -0,0 +1,87 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDocumentWithAttachmentStream(t *testing.T) {
+	t.Log("Testing doc create with an attachment of unknown size")
+	pr, pw := io.Pipe()
+	read := make(chan struct{})
+	var sent []string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req.Method+" "+req.URL.RequestURI())
+		body := `{"ok":true,"id":"a","rev":"1-a"}`
+		if strings.HasSuffix(req.URL.Path, "/hello.txt") {
+			assert.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+			data := make([]byte, 5)
+			_, err := io.ReadFull(req.Body, data)
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(data))
+			close(read)
+			rest, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, " world", string(rest))
+			body = `{"ok":true,"id":"a","rev":"2-b"}`
+		} else {
+			var doc map[string]interface{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&doc))
+			assert.Equal(t, map[string]interface{}{"_id": "a", "name": "test"}, doc)
+		}
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt).DB("db")
+	go func() {
+		pw.Write([]byte("hello"))
+		// The attachment must be sent before the reader is done.
+		select {
+		case <-read:
+			pw.Write([]byte(" world"))
+			pw.Close()
+		case <-time.After(time.Second):
+			pw.CloseWithError(errors.New("attachment read into memory"))
+		}
+	}()
+	doc := map[string]string{"_id": "a", "name": "test"}
+	id, rev, err := db.CreateDocumentWithAttachment(doc, "dir/hello.txt", "text/plain", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", id)
+	assert.Equal(t, "2-b", rev)
+	assert.Equal(t, []string{"PUT /db/a", "PUT /db/a/dir%2Fhello.txt?rev=1-a"}, sent)
+}
+
+func TestAttachmentPathEscape(t *testing.T) {
+	t.Log("Testing doc ids and attachment names are escaped in attachment URLs")
+	var sent []string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req.URL.EscapedPath())
+		return okResponse(req)
+	})
+	db := newTestClient(t, rt).DB("db")
+
+	att, err := db.GetAttachment("a/b c", "dir/x?.txt", nil)
+	if assert.NoError(t, err) {
+		att.Body.Close()
+	}
+	_, err = db.GetAttachments([]AttachmentRef{{DocID: "_design/d#1", Name: "f"}}, 1)
+	assert.NoError(t, err)
+	_, err = db.ListAttachments("_local/a?b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/db/a%2Fb%20c/dir%2Fx%3F.txt",
+		"/db/_design/d%231/f",
+		"/db/_local/a%3Fb",
+	}, sent)
+}
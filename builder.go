@@ -0,0 +1,43 @@
+package cloudant
+
+// QueryBuilder builds a Query step by step.
+type QueryBuilder struct {
+	query Query
+}
+
+// NewQueryBuilder returns a QueryBuilder for a query with the given
+// selector.
+func NewQueryBuilder(selector map[string]interface{}) *QueryBuilder {
+	return &QueryBuilder{Query{Selector: selector}}
+}
+
+// SortAsc sorts the results by field in ascending order, after the sort
+// fields already given.
+func (b *QueryBuilder) SortAsc(field string) *QueryBuilder {
+	b.query.Sort = append(b.query.Sort, map[string]string{field: "asc"})
+	return b
+}
+
+// SortDesc sorts the results by field in descending order, after the sort
+// fields already given.
+func (b *QueryBuilder) SortDesc(field string) *QueryBuilder {
+	b.query.Sort = append(b.query.Sort, map[string]string{field: "desc"})
+	return b
+}
+
+// Fields sets the fields returned for each document.
+func (b *QueryBuilder) Fields(fields ...string) *QueryBuilder {
+	b.query.Fields = fields
+	return b
+}
+
+// Limit sets the maximum number of results.
+func (b *QueryBuilder) Limit(n int) *QueryBuilder {
+	b.query.Limit = n
+	return b
+}
+
+// Build returns the query.
+func (b *QueryBuilder) Build() Query {
+	return b.query
+}
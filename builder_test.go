@@ -0,0 +1,25 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryBuilderSort(t *testing.T) {
+	t.Log("Testing query builder sort")
+	query := NewQueryBuilder(map[string]interface{}{"name": "test"}).
+		SortAsc("name").
+		SortDesc("created").
+		Limit(10).
+		Build()
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"selector": {"name": "test"},
+		"sort": [{"name": "asc"}, {"created": "desc"}],
+		"limit": 10
+	}`, string(data))
+	assert.Contains(t, string(data), `"sort":[{"name":"asc"},{"created":"desc"}]`)
+}
@@ -0,0 +1,383 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// BulkResult is the result of writing a document in a bulk request. OK is
+// set if the document was written, and Error and Reason otherwise.
+type BulkResult struct {
+	ID     string `json:"id"`
+	Rev    string `json:"rev"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// IsConflict reports whether the document was not written because its
+// revision is not the current one.
+func (r BulkResult) IsConflict() bool {
+	return r.Error == "conflict"
+}
+
+// IsForbidden reports whether the document was rejected by a validation
+// function, or by the permissions of the user.
+func (r BulkResult) IsForbidden() bool {
+	return r.Error == "forbidden" || r.Error == "unauthorized"
+}
+
+// BulkOptions configures BulkCreate.
+type BulkOptions struct {
+	// ReturnSeq makes BulkCreate also return the update sequence of the
+	// database after the write, at the cost of an extra request. Writes
+	// from other clients may be included before that sequence.
+	ReturnSeq bool
+	// AllOrNothing sets the legacy all_or_nothing flag of _bulk_docs,
+	// asking for all the documents to be written or none. It is not
+	// honored by clustered databases, doesn't make the write atomic for
+	// readers, and may create conflicting revisions rather than reporting
+	// conflicts. It is kept for pipelines relying on it.
+	AllOrNothing bool
+	// MaxDocSize is the maximum size of the JSON encoding of a document, in
+	// bytes. It defaults to DefaultMaxDocSize.
+	MaxDocSize int
+}
+
+// DefaultMaxDocSize is the maximum size of a document accepted by Cloudant.
+const DefaultMaxDocSize = 1 << 20
+
+// BulkCreate writes docs in a single request and returns the result of
+// each document, in order. Documents failing individually are reported in
+// their result rather than as an error. With opts.ReturnSeq, the update
+// sequence following the write is returned, for a changes feed to start
+// from. If documents are larger than opts.MaxDocSize, nothing is written
+// and they are reported in a *BulkError.
+func (db *DB) BulkCreate(docs []interface{}, opts BulkOptions) (results []BulkResult, seq string, err error) {
+	if docs, err = db.checkDocSizes(docs, opts.MaxDocSize); err != nil {
+		return nil, "", err
+	}
+	body := map[string]interface{}{"docs": docs}
+	if opts.AllOrNothing {
+		body["all_or_nothing"] = true
+	}
+	if results, err = db.bulkDocsBody(body); err != nil {
+		return nil, "", err
+	}
+	if opts.ReturnSeq {
+		info, err := db.Info()
+		if err != nil {
+			return results, "", err
+		}
+		seq = string(info.UpdateSeq)
+	}
+	return results, seq, nil
+}
+
+// IdentifiedDoc is a document along with its id.
+type IdentifiedDoc struct {
+	ID  string
+	Doc interface{}
+}
+
+// EnsureDocuments creates those of docs that don't exist yet, in a single
+// bulk request, and returns the results of the created documents. Existing
+// documents are left untouched, while deleted ones are created again.
+func (db *DB) EnsureDocuments(docs []IdentifiedDoc) ([]BulkResult, error) {
+	keys := make([]string, len(docs))
+	for i, doc := range docs {
+		keys[i] = doc.ID
+	}
+	rows, err := db.AllDocsByKeys(keys, false)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if row.Error == "" && !row.Value.Deleted {
+			exists[row.ID] = true
+		}
+	}
+	var missing []interface{}
+	for _, doc := range docs {
+		if exists[doc.ID] {
+			continue
+		}
+		fields, err := db.docFields(doc.Doc)
+		if err != nil {
+			return nil, err
+		}
+		fields["_id"] = doc.ID
+		missing = append(missing, fields)
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	return db.bulkDocs(missing)
+}
+
+// checkDocSizes returns the JSON encodings of docs, or a *BulkError listing
+// the documents larger than maxSize bytes, by index and id.
+func (db *DB) checkDocSizes(docs []interface{}, maxSize int) ([]interface{}, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDocSize
+	}
+	encoded := make([]interface{}, len(docs))
+	bulkErr := &BulkError{}
+	for i, doc := range docs {
+		doc, err := db.marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxSize {
+			var meta struct {
+				ID string `json:"_id"`
+			}
+			json.Unmarshal(data, &meta)
+			reason := fmt.Sprintf("document %d is %d bytes, over the limit of %d", i, len(data), maxSize)
+			bulkErr.Docs = append(bulkErr.Docs, DocError{meta.ID, "document_too_large", reason})
+		}
+		encoded[i] = json.RawMessage(data)
+	}
+	if len(bulkErr.Docs) > 0 {
+		return nil, bulkErr
+	}
+	return encoded, nil
+}
+
+// bulkDocs writes docs in a single _bulk_docs request and returns the
+// result of each document, in order.
+func (db *DB) bulkDocs(docs []interface{}) ([]BulkResult, error) {
+	return db.bulkDocsBody(map[string]interface{}{"docs": docs})
+}
+
+// bulkDocsBody sends a _bulk_docs request with the given body, and returns
+// the result of each document. The body is sent as encoded, so that
+// documents encoded with WithJSON keep the order of their fields.
+func (db *DB) bulkDocsBody(body map[string]interface{}) ([]BulkResult, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var results []BulkResult
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_bulk_docs")
+	req.BounceToRawString = true
+	req.SendString(string(data))
+	if err := db.client.end(req, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BulkGetRef identifies a document to fetch with BulkGet. If Rev is empty,
+// the winning revision is fetched.
+type BulkGetRef struct {
+	ID  string `json:"id"`
+	Rev string `json:"rev,omitempty"`
+}
+
+// BulkGetOptions configures BulkGet.
+type BulkGetOptions struct {
+	// Revs includes the revision history of each document.
+	Revs bool
+	// Attachments includes the content of attachments.
+	Attachments bool
+	// Latest fetches the latest leaf revisions descending from the requested
+	// revisions, rather than the revisions themselves.
+	Latest bool
+	// Fields trims the documents to the given fields. _bulk_get has no
+	// projection, so full documents are still transferred and trimmed once
+	// received, which only saves memory.
+	Fields []string
+}
+
+// BulkGetResult is a document revision fetched by BulkGet. Either Doc or
+// Error is set.
+type BulkGetResult struct {
+	ID    string
+	Doc   json.RawMessage
+	Error *DocError
+}
+
+// BulkGet fetches the given document revisions in a single request. A
+// reference may yield several results, one per leaf revision with
+// opts.Latest. Revisions failing individually are reported in their result
+// rather than as an error.
+func (db *DB) BulkGet(refs []BulkGetRef, opts BulkGetOptions) ([]BulkGetResult, error) {
+	var data struct {
+		Results []struct {
+			ID   string `json:"id"`
+			Docs []struct {
+				OK    json.RawMessage `json:"ok"`
+				Error *struct {
+					ID     string `json:"id"`
+					Error  string `json:"error"`
+					Reason string `json:"reason"`
+				} `json:"error"`
+			} `json:"docs"`
+		} `json:"results"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_bulk_get")
+	if opts.Revs {
+		req.Param("revs", "true")
+	}
+	if opts.Attachments {
+		req.Param("attachments", "true")
+	}
+	if opts.Latest {
+		req.Param("latest", "true")
+	}
+	req.Send(map[string]interface{}{"docs": refs})
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	var results []BulkGetResult
+	for _, result := range data.Results {
+		for _, doc := range result.Docs {
+			r := BulkGetResult{ID: result.ID, Doc: doc.OK}
+			if doc.Error != nil {
+				r.Doc = nil
+				r.Error = &DocError{doc.Error.ID, doc.Error.Error, doc.Error.Reason}
+			} else if opts.Fields != nil {
+				projected, err := ProjectFields(doc.OK, opts.Fields)
+				if err != nil {
+					return nil, err
+				}
+				r.Doc = projected
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// BatchWriter groups documents added one by one into _bulk_docs requests.
+// A batch is written when it reaches its maximum size, or when the oldest
+// document in it has waited for the maximum interval. Batches are written
+// without blocking the documents added meanwhile, and may be written
+// concurrently.
+type BatchWriter struct {
+	db          *DB
+	maxDocs     int
+	maxInterval time.Duration
+	writing     sync.WaitGroup
+
+	mu    sync.Mutex
+	docs  []interface{}
+	timer *time.Timer
+	err   error
+}
+
+// NewBatchWriter returns a BatchWriter writing batches of up to maxDocs
+// documents, and waiting no longer than maxInterval before writing a batch.
+// It must be closed to write the last batch.
+func (db *DB) NewBatchWriter(maxDocs int, maxInterval time.Duration) *BatchWriter {
+	return &BatchWriter{db: db, maxDocs: maxDocs, maxInterval: maxInterval}
+}
+
+// Add adds doc to the current batch, and writes the batch if it is full.
+// Errors from batches written in the background are returned by the next
+// call to Add, Flush or Close. Documents failing individually are reported
+// in a *BulkError.
+func (w *BatchWriter) Add(doc interface{}) error {
+	doc, err := w.db.marshal(doc)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.docs = append(w.docs, doc)
+	var batch []interface{}
+	if len(w.docs) >= w.maxDocs {
+		batch = w.take()
+	} else if w.timer == nil && w.maxInterval > 0 {
+		w.timer = time.AfterFunc(w.maxInterval, w.flushTimer)
+	}
+	w.mu.Unlock()
+	w.write(batch)
+	return w.takeErr()
+}
+
+// Flush writes the current batch, and waits for the batches being written.
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	batch := w.take()
+	w.mu.Unlock()
+	w.write(batch)
+	w.writing.Wait()
+	return w.takeErr()
+}
+
+// Close writes the current batch, and must be called once all documents
+// have been added.
+func (w *BatchWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *BatchWriter) flushTimer() {
+	w.mu.Lock()
+	batch := w.take()
+	w.mu.Unlock()
+	w.write(batch)
+}
+
+// take returns the current batch, to be written with write, and starts a
+// new one. It must be called with mu held.
+func (w *BatchWriter) take() []interface{} {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	batch := w.docs
+	w.docs = nil
+	if len(batch) > 0 {
+		w.writing.Add(1)
+	}
+	return batch
+}
+
+// write writes a batch returned by take, keeping the first error until it
+// is taken. It must be called without mu held.
+func (w *BatchWriter) write(batch []interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	defer w.writing.Done()
+	results, err := w.db.bulkDocs(batch)
+	if err == nil {
+		bulkErr := &BulkError{}
+		for _, result := range results {
+			if result.Error != "" {
+				bulkErr.Docs = append(bulkErr.Docs, DocError{result.ID, result.Error, result.Reason})
+			}
+		}
+		if len(bulkErr.Docs) > 0 {
+			err = bulkErr
+		}
+	}
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
+
+// takeErr returns and clears the pending error.
+func (w *BatchWriter) takeErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
@@ -0,0 +1,162 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDocSizes(t *testing.T) {
+	t.Log("Testing bulk document size check")
+	docs := []interface{}{
+		map[string]string{"name": "small"},
+		map[string]string{"_id": "big", "name": strings.Repeat("x", 100)},
+	}
+	db := &DB{client: &Client{}}
+	encoded, err := db.checkDocSizes(docs, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`{"name":"small"}`), encoded[0])
+
+	_, err = db.checkDocSizes(docs, 50)
+	bulkErr, ok := err.(*BulkError)
+	assert.True(t, ok, "Expected bulk error for large document")
+	assert.Len(t, bulkErr.Docs, 1)
+	assert.Equal(t, "big", bulkErr.Docs[0].ID)
+	assert.Equal(t, "document_too_large", bulkErr.Docs[0].Error)
+
+	db.client.jsonMarshal = func(v interface{}) ([]byte, error) {
+		return []byte(`{"name":"custom"}`), nil
+	}
+	encoded, err = db.checkDocSizes(docs[:1], 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`{"name":"custom"}`), encoded[0])
+}
+
+func TestBulkResult(t *testing.T) {
+	t.Log("Testing bulk result decoding")
+	var results []BulkResult
+	data := `[
+		{"ok": true, "id": "a", "rev": "1-abc"},
+		{"id": "b", "error": "conflict", "reason": "Document update conflict."},
+		{"id": "c", "error": "forbidden", "reason": "invalid document"}
+	]`
+	assert.NoError(t, json.Unmarshal([]byte(data), &results))
+	assert.True(t, results[0].OK)
+	assert.False(t, results[0].IsConflict())
+	assert.False(t, results[1].OK)
+	assert.True(t, results[1].IsConflict())
+	assert.False(t, results[1].IsForbidden())
+	assert.True(t, results[2].IsForbidden())
+}
+
+func TestEnsureDocumentsWithJSON(t *testing.T) {
+	t.Log("Testing ensure documents with custom JSON functions")
+	var sent string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"rows":[{"id":"a","key":"a","value":{"rev":"1-a"}},{"key":"b","error":"not_found"}]}`
+		if req.URL.Path == "/db/_bulk_docs" {
+			data, _ := ioutil.ReadAll(req.Body)
+			sent = string(data)
+			body = `[{"ok":true,"id":"b","rev":"1-b"}]`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	marshalled, unmarshalled := 0, 0
+	db := newTestClient(t, rt, WithJSON(
+		func(v interface{}) ([]byte, error) {
+			marshalled++
+			return []byte(`{"name":"custom"}`), nil
+		},
+		func(data []byte, v interface{}) error {
+			unmarshalled++
+			return json.Unmarshal(data, v)
+		},
+	)).DB("db")
+	results, err := db.EnsureDocuments([]IdentifiedDoc{
+		{"a", map[string]string{"name": "a"}},
+		{"b", map[string]string{"name": "b"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, 1, marshalled)
+	assert.Equal(t, 1, unmarshalled)
+	assert.Contains(t, sent, `"name":"custom"`)
+	assert.Contains(t, sent, `"_id":"b"`)
+}
+
+func TestBatchWriterAddWhileWriting(t *testing.T) {
+	t.Log("Testing adding documents while a batch is written")
+	writing := make(chan string, 2)
+	release := make(chan struct{})
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := ioutil.ReadAll(req.Body)
+		writing <- string(data)
+		<-release
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       ioutil.NopCloser(strings.NewReader(`[{"ok":true},{"ok":true}]`)),
+			Request:    req,
+		}, nil
+	})
+	marshalled := 0
+	db := newTestClient(t, rt, WithJSON(
+		func(v interface{}) ([]byte, error) {
+			marshalled++
+			return json.Marshal(v)
+		},
+		json.Unmarshal,
+	)).DB("db")
+	w := db.NewBatchWriter(2, 0)
+	done := make(chan error)
+	go func() {
+		w.Add(map[string]string{"name": "a"})
+		done <- w.Add(map[string]string{"name": "b"})
+	}()
+	assert.Contains(t, <-writing, `"name":"b"`)
+
+	added := make(chan error)
+	go func() { added <- w.Add(map[string]string{"name": "c"}) }()
+	select {
+	case err := <-added:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Add blocked while a batch was written")
+	}
+	close(release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, w.Close())
+	assert.Contains(t, <-writing, `"name":"c"`)
+	assert.Equal(t, 3, marshalled)
+}
+
+func TestBulkCreateWithJSON(t *testing.T) {
+	t.Log("Testing bulk create keeps the encoding of custom JSON functions")
+	var sent string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := ioutil.ReadAll(req.Body)
+		sent = string(data)
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       ioutil.NopCloser(strings.NewReader(`[{"ok":true,"id":"a","rev":"1-a"}]`)),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt, WithJSON(
+		func(v interface{}) ([]byte, error) {
+			return []byte(`{"_id":"a","zebra":1,"apple":2}`), nil
+		},
+		json.Unmarshal,
+	)).DB("db")
+	_, _, err := db.BulkCreate([]interface{}{map[string]int{"ignored": 0}}, BulkOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"docs":[{"_id":"a","zebra":1,"apple":2}]}`, sent, "Field order should be kept")
+}
@@ -0,0 +1,105 @@
+package cloudant
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// docCache is a least recently used cache of document bodies, keyed by
+// document URL and tagged with their revision.
+type docCache struct {
+	size int
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	rev  string
+	body []byte
+}
+
+func newDocCache(size int) *docCache {
+	return &docCache{size: size, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the cached revision and body of the document at key.
+func (c *docCache) get(key string) (rev string, body []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", nil, false
+	}
+	c.lru.MoveToFront(e)
+	entry := e.Value.(*cacheEntry)
+	return entry.rev, entry.body, true
+}
+
+// put caches a revision of the document at key, evicting the least
+// recently used document if the cache is full.
+func (c *docCache) put(key, rev string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.lru.MoveToFront(e)
+		e.Value = &cacheEntry{key, rev, body}
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key, rev, body})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// remove removes the document at key from the cache.
+func (c *docCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.lru.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// getCached decodes the document id into doc, serving it from the cache of
+// the client if the server reports it unchanged.
+func (db *DB) getCached(id string, doc interface{}) error {
+	key := db.path + "/" + id
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(key)
+	rev, body, cached := db.client.cache.get(key)
+	if cached {
+		req.Set("If-None-Match", `"`+rev+`"`)
+	}
+	resp, data, err := db.client.send(req)
+	if err != nil {
+		return err
+	}
+	if cached && resp.StatusCode == http.StatusNotModified {
+		return db.unmarshal(body, doc)
+	}
+	if err := responseError(resp, data); err != nil {
+		db.client.cache.remove(key)
+		return err
+	}
+	db.client.cache.put(key, strings.Trim(resp.Header.Get("ETag"), `"`), data)
+	return db.unmarshal(data, doc)
+}
+
+// InvalidateCache removes the document id from the cache enabled by
+// WithDocumentCache.
+func (db *DB) InvalidateCache(id string) {
+	if db.client.cache != nil {
+		db.client.cache.remove(db.path + "/" + id)
+	}
+}
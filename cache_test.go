@@ -0,0 +1,31 @@
+package cloudant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocCache(t *testing.T) {
+	t.Log("Testing LRU document cache")
+	c := newDocCache(2)
+	c.put("a", "1-a", []byte("a"))
+	c.put("b", "1-b", []byte("b"))
+	_, _, ok := c.get("a")
+	assert.True(t, ok)
+	c.put("c", "1-c", []byte("c"))
+
+	_, _, ok = c.get("b")
+	assert.False(t, ok, "Least recently used document should be evicted")
+	rev, body, ok := c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1-a", rev)
+	assert.Equal(t, "a", string(body))
+
+	c.put("a", "2-a", []byte("a2"))
+	rev, _, _ = c.get("a")
+	assert.Equal(t, "2-a", rev)
+	c.remove("a")
+	_, _, ok = c.get("a")
+	assert.False(t, ok)
+}
@@ -0,0 +1,467 @@
+package cloudant
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ChangesOptions configures a changes feed.
+// Cloudant doc: https://docs.cloudant.com/database.html#get-changes
+type ChangesOptions struct {
+	// Since is the sequence after which changes are returned. "now" starts
+	// from the current sequence, and the default from the beginning.
+	Since string
+	// Limit is the maximum number of changes returned, if not zero.
+	Limit int
+	// IncludeDocs includes the changed documents in the rows.
+	IncludeDocs bool
+	// Heartbeat makes the server send a newline at this interval while
+	// there are no changes, keeping the connection alive and making a
+	// stalled connection detectable. It overrides Timeout.
+	Heartbeat time.Duration
+	// Timeout is how long the server waits for changes before ending the
+	// feed.
+	Timeout time.Duration
+	// Filter is the name of a filter function, as "ddoc/filter", that
+	// selects the changes returned.
+	Filter string
+	// Selector selects the changes returned by the documents they match,
+	// using the built-in _selector filter. It takes precedence over Filter.
+	Selector map[string]interface{}
+	// SeqInterval makes the server include the sequence only in every
+	// SeqInterval-th row, which reduces the load of large feeds. Rows
+	// without a sequence have an empty Seq.
+	SeqInterval int
+}
+
+// request builds a request for the changes feed of db. Feeds filtered by a
+// selector are requested with POST, sending the selector in the body.
+func (opts *ChangesOptions) request(db *DB) *request.SuperAgent {
+	req := request.New().SetBasicAuth(db.username, db.password)
+	if opts.Selector != nil {
+		req.Post(db.path+"/_changes").
+			Param("filter", "_selector").
+			Send(map[string]interface{}{"selector": opts.Selector})
+	} else {
+		req.Get(db.path + "/_changes")
+		if opts.Filter != "" {
+			req.Param("filter", opts.Filter)
+		}
+	}
+	if opts.Since != "" {
+		req.Param("since", opts.Since)
+	}
+	if opts.Limit > 0 {
+		req.Param("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.IncludeDocs {
+		req.Param("include_docs", "true")
+	}
+	if opts.SeqInterval > 0 {
+		req.Param("seq_interval", strconv.Itoa(opts.SeqInterval))
+	}
+	if opts.Heartbeat > 0 {
+		req.Param("heartbeat", strconv.FormatInt(int64(opts.Heartbeat/time.Millisecond), 10))
+	}
+	if opts.Timeout > 0 {
+		req.Param("timeout", strconv.FormatInt(int64(opts.Timeout/time.Millisecond), 10))
+	}
+	return req
+}
+
+// Seq is an update sequence. It is an opaque string on Cloudant and
+// CouchDB 2, and a number on earlier CouchDB versions.
+type Seq string
+
+// UnmarshalJSON accepts both string and numeric sequences.
+func (s *Seq) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = Seq(str)
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	*s = Seq(data)
+	return nil
+}
+
+// ChangeRow is a row of a changes feed.
+type ChangeRow struct {
+	Seq     Seq    `json:"seq"`
+	ID      string `json:"id"`
+	Changes []struct {
+		Rev string `json:"rev"`
+	} `json:"changes"`
+	Deleted bool            `json:"deleted"`
+	Doc     json.RawMessage `json:"doc,omitempty"`
+
+	db *DB
+}
+
+// ErrDeletedDoc is returned by ChangeRow.DecodeDoc for changes deleting a
+// document.
+var ErrDeletedDoc = errors.New("document deleted")
+
+// ErrNoDoc is returned by ChangeRow.DecodeDoc when the feed wasn't read
+// with IncludeDocs.
+var ErrNoDoc = errors.New("document not included in the change")
+
+// DecodeDoc decodes the changed document into out, honoring WithJSON and
+// WithUseNumber for rows read from a database. It returns ErrDeletedDoc if
+// the change deleted the document, so that consumers can skip it, and
+// ErrNoDoc if the document wasn't included.
+func (row *ChangeRow) DecodeDoc(out interface{}) error {
+	if row.Deleted {
+		return ErrDeletedDoc
+	}
+	if len(row.Doc) == 0 || bytes.Equal(row.Doc, []byte("null")) {
+		return ErrNoDoc
+	}
+	if row.db != nil {
+		return row.db.unmarshal(row.Doc, out)
+	}
+	return json.Unmarshal(row.Doc, out)
+}
+
+// ChangesResp is a batch of changes.
+type ChangesResp struct {
+	Results []ChangeRow `json:"results"`
+	LastSeq Seq         `json:"last_seq"`
+	Pending int         `json:"pending"`
+}
+
+// Changes returns the changes made to the database since opts.Since.
+func (db *DB) Changes(opts ChangesOptions) (*ChangesResp, error) {
+	body := &ChangesResp{}
+	if err := db.client.end(opts.request(db), body); err != nil {
+		return nil, err
+	}
+	for i := range body.Results {
+		body.Results[i].db = db
+	}
+	return body, nil
+}
+
+// ChangedDocsSince calls fn with each document changed since the sequence
+// since, and returns the sequence to resume from next time. Deleted
+// documents are passed as tombstones, holding only _id, _rev and
+// "_deleted": true. If fn returns an error, the iteration stops and the
+// sequence of the last document processed is returned with the error.
+func (db *DB) ChangedDocsSince(since string, fn func(doc json.RawMessage) error) (newSince string, err error) {
+	opts := ChangesOptions{Since: since, Limit: queryPageSize, IncludeDocs: true}
+	for {
+		changes, err := db.Changes(opts)
+		if err != nil {
+			return opts.Since, err
+		}
+		for _, row := range changes.Results {
+			doc := row.Doc
+			if row.Deleted {
+				rev := ""
+				if len(row.Changes) > 0 {
+					rev = row.Changes[0].Rev
+				}
+				doc, _ = json.Marshal(map[string]interface{}{"_id": row.ID, "_rev": rev, "_deleted": true})
+			}
+			if err := fn(doc); err != nil {
+				return opts.Since, err
+			}
+			if row.Seq != "" {
+				opts.Since = string(row.Seq)
+			}
+		}
+		if changes.LastSeq != "" {
+			opts.Since = string(changes.LastSeq)
+		}
+		if len(changes.Results) < opts.Limit {
+			return opts.Since, nil
+		}
+	}
+}
+
+// ErrIteratorClosed is returned by ChangesIterator.Err after Close.
+var ErrIteratorClosed = errors.New("changes iterator closed")
+
+// ChangesIterator reads a continuous changes feed.
+type ChangesIterator struct {
+	db   *DB
+	opts ChangesOptions
+	row  ChangeRow
+	err  error
+	done chan struct{}
+	once sync.Once
+
+	// mu guards the connection, which Close tears down concurrently with
+	// Next.
+	mu     sync.Mutex
+	resp   *http.Response
+	lines  chan []byte
+	stop   chan struct{}
+	reader chan struct{}
+}
+
+// ContinuousChanges returns an iterator over the continuous changes feed of
+// the database. The feed is read lazily by calls to Next.
+func (db *DB) ContinuousChanges(opts ChangesOptions) *ChangesIterator {
+	return &ChangesIterator{db: db, opts: opts, done: make(chan struct{})}
+}
+
+// Next waits for the next change and reports whether there is one. It
+// returns false when the server ends the feed, on error, or after Close.
+// When the connection is lost, or when Heartbeat is set and no heartbeat
+// arrives within twice its interval, Next reconnects from the last sequence
+// seen.
+func (it *ChangesIterator) Next() bool {
+	for it.err == nil {
+		it.mu.Lock()
+		lines := it.lines
+		it.mu.Unlock()
+		if lines == nil {
+			if err := it.connect(); err != nil {
+				it.err = err
+				return false
+			}
+			continue
+		}
+		var stall <-chan time.Time
+		if it.opts.Heartbeat > 0 {
+			stall = time.After(2 * it.opts.Heartbeat)
+		}
+		select {
+		case <-it.done:
+			it.err = ErrIteratorClosed
+		case <-stall:
+			it.disconnect()
+		case line, ok := <-lines:
+			if !ok {
+				it.disconnect()
+				continue
+			}
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			var row struct {
+				ChangeRow
+				LastSeq Seq `json:"last_seq"`
+			}
+			if err := json.Unmarshal(line, &row); err != nil {
+				it.err = err
+				break
+			}
+			if row.ID == "" && row.LastSeq != "" {
+				it.opts.Since = string(row.LastSeq)
+				it.disconnect()
+				return false
+			}
+			it.row = row.ChangeRow
+			it.row.db = it.db
+			if row.Seq != "" {
+				it.opts.Since = string(row.Seq)
+			}
+			return true
+		}
+	}
+	it.disconnect()
+	return false
+}
+
+// Row returns the change read by the last call to Next.
+func (it *ChangesIterator) Row() *ChangeRow {
+	return &it.row
+}
+
+// Seq returns the last sequence seen, from which the feed can be resumed.
+// With SeqInterval, it is carried forward over rows without a sequence.
+func (it *ChangesIterator) Seq() string {
+	return it.opts.Since
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ChangesIterator) Err() error {
+	if it.err == ErrIteratorClosed {
+		return nil
+	}
+	return it.err
+}
+
+// Close stops the iteration, and closes the connection to the feed. It can
+// be called concurrently with Next.
+func (it *ChangesIterator) Close() error {
+	it.once.Do(func() { close(it.done) })
+	it.disconnect()
+	return nil
+}
+
+func (it *ChangesIterator) connect() error {
+	req := it.opts.request(it.db).Param("feed", "continuous")
+	resp, err := it.db.client.stream(req)
+	if err != nil {
+		return err
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	select {
+	case <-it.done:
+		resp.Body.Close()
+		return ErrIteratorClosed
+	default:
+	}
+	lines := make(chan []byte)
+	stop := make(chan struct{})
+	reader := make(chan struct{})
+	go func() {
+		defer close(reader)
+		defer close(lines)
+		r := bufio.NewReader(resp.Body)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	it.resp, it.lines, it.stop, it.reader = resp, lines, stop, reader
+	return nil
+}
+
+// disconnect closes the connection to the feed, if any, and waits for its
+// reader to stop.
+func (it *ChangesIterator) disconnect() {
+	it.mu.Lock()
+	if it.lines == nil {
+		it.mu.Unlock()
+		return
+	}
+	close(it.stop)
+	it.resp.Body.Close()
+	reader := it.reader
+	it.resp, it.lines, it.stop, it.reader = nil, nil, nil, nil
+	it.mu.Unlock()
+	<-reader
+}
+
+// watchHeartbeat is the heartbeat interval of the feed used by Watch.
+const watchHeartbeat = 30 * time.Second
+
+// Watch delivers the documents matching selector as they change, starting
+// from the current sequence. It follows a continuous changes feed filtered
+// by the selector, reconnecting as needed. Both channels are closed when
+// ctx is done, or after sending an error if the feed fails.
+func (db *DB) Watch(ctx context.Context, selector map[string]interface{}) (<-chan json.RawMessage, <-chan error) {
+	docs := make(chan json.RawMessage)
+	errc := make(chan error, 1)
+	it := db.ContinuousChanges(ChangesOptions{
+		Since:       "now",
+		IncludeDocs: true,
+		Heartbeat:   watchHeartbeat,
+		Selector:    selector,
+	})
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			it.Close()
+		case <-stop:
+		}
+	}()
+	go func() {
+		defer close(errc)
+		defer close(docs)
+		defer close(stop)
+		// Closing the iterator disconnects from the feed, whichever way
+		// the loop ends.
+		defer it.Close()
+		for {
+			for it.Next() {
+				select {
+				case docs <- it.Row().Doc:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// The feed ends without error on a last_seq row, and the next
+			// call to Next reconnects from there.
+			if ctx.Err() != nil {
+				return
+			}
+			if err := it.Err(); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	return docs, errc
+}
+
+// ConsumeChanges calls handler with the changes of the database in batches
+// of up to batchSize rows, until it has caught up with the feed or ctx is
+// done. The sequence reached is checkpointed in the _local document named
+// after consumerID once handler succeeds, so that a consumer restarted
+// with the same id resumes after the last batch handled. A batch whose
+// handler fails is delivered again on the next run.
+func (db *DB) ConsumeChanges(ctx context.Context, consumerID string, batchSize int, handler func([]ChangeRow) error) error {
+	if batchSize <= 0 {
+		batchSize = queryPageSize
+	}
+	cp := checkpoint{ID: "_local/" + consumerID}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/" + cp.ID)
+	if err := db.client.end(req, &cp); err != nil && !IsNotFound(err) {
+		return err
+	}
+	opts := ChangesOptions{Limit: batchSize}
+	if len(cp.LastSeq) > 0 {
+		opts.Since = seqString(cp.LastSeq)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		changes, err := db.Changes(opts)
+		if err != nil {
+			return err
+		}
+		if len(changes.Results) == 0 {
+			return nil
+		}
+		if err := handler(changes.Results); err != nil {
+			return err
+		}
+		opts.Since = string(changes.LastSeq)
+		if cp.LastSeq, err = json.Marshal(opts.Since); err != nil {
+			return err
+		}
+		var saved BulkResult
+		req = request.New().
+			SetBasicAuth(db.username, db.password).
+			Put(db.path + "/" + cp.ID).
+			Send(cp)
+		if err := db.client.end(req, &saved); err != nil {
+			return err
+		}
+		cp.Rev = saved.Rev
+		if len(changes.Results) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cloudant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRowDecodeDoc(t *testing.T) {
+	t.Log("Testing decoding of changed documents")
+	var item struct {
+		Name string `json:"name"`
+	}
+	row := ChangeRow{ID: "a", Doc: json.RawMessage(`{"_id":"a","name":"x"}`)}
+	assert.NoError(t, row.DecodeDoc(&item))
+	assert.Equal(t, "x", item.Name)
+
+	row = ChangeRow{ID: "a", Deleted: true, Doc: json.RawMessage(`{"_id":"a","_deleted":true}`)}
+	assert.Equal(t, ErrDeletedDoc, row.DecodeDoc(&item))
+
+	row = ChangeRow{ID: "a"}
+	assert.Equal(t, ErrNoDoc, row.DecodeDoc(&item))
+}
+
+func TestChangesDecodeDocWithJSON(t *testing.T) {
+	t.Log("Testing decoding of changed documents with custom JSON functions")
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results":[{"seq":"1","id":"a","doc":{"_id":"a","name":"x"}}],"last_seq":"1"}`)),
+			Request:    req,
+		}, nil
+	})
+	unmarshalled := 0
+	c := newTestClient(t, rt, WithJSON(json.Marshal, func(data []byte, v interface{}) error {
+		unmarshalled++
+		return json.Unmarshal(data, v)
+	}))
+
+	changes, err := c.DB("db").Changes(ChangesOptions{IncludeDocs: true})
+	assert.NoError(t, err)
+	assert.Len(t, changes.Results, 1)
+	var item struct {
+		Name string `json:"name"`
+	}
+	assert.NoError(t, changes.Results[0].DecodeDoc(&item))
+	assert.Equal(t, "x", item.Name)
+	assert.Equal(t, 1, unmarshalled)
+}
+
+// feedBody is the body of a stub changes feed, recording when it is closed.
+type feedBody struct {
+	*io.PipeReader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (b *feedBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return b.PipeReader.Close()
+}
+
+// feedClient returns a client whose requests get a stub changes feed,
+// written to the returned pipe.
+func feedClient(t *testing.T) (*Client, *io.PipeWriter, *feedBody) {
+	pr, pw := io.Pipe()
+	body := &feedBody{PipeReader: pr, closed: make(chan struct{})}
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+	})
+	c := newTestClient(t, rt)
+	return c, pw, body
+}
+
+func TestChangesIteratorClose(t *testing.T) {
+	t.Log("Testing closing a continuous changes iterator")
+	c, pw, body := feedClient(t)
+	it := c.DB("db").ContinuousChanges(ChangesOptions{})
+	go pw.Write([]byte(`{"seq":"1-a","id":"a","changes":[{"rev":"1-a"}]}` + "\n"))
+	assert.True(t, it.Next())
+	assert.Equal(t, "a", it.Row().ID)
+
+	assert.NoError(t, it.Close())
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close should close the connection")
+	}
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+
+	c, _, body = feedClient(t)
+	it = c.DB("db").ContinuousChanges(ChangesOptions{})
+	time.AfterFunc(20*time.Millisecond, func() { it.Close() })
+	assert.False(t, it.Next(), "Close should stop a waiting Next")
+	assert.NoError(t, it.Err())
+	<-body.closed
+}
+
+func TestWatchCancel(t *testing.T) {
+	t.Log("Testing canceling a watch")
+	c, pw, body := feedClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errc := c.DB("db").Watch(ctx, map[string]interface{}{"name": "x"})
+	go pw.Write([]byte(`{"seq":"1-a","id":"a","changes":[{"rev":"1-a"}],"doc":{"_id":"a"}}` + "\n"))
+	assert.JSONEq(t, `{"_id":"a"}`, string(<-docs))
+
+	cancel()
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Canceling should close the connection")
+	}
+	for range docs {
+	}
+	assert.NoError(t, <-errc)
+}
@@ -1,33 +1,139 @@
 package cloudant
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	request "github.com/parnurzeal/gorequest"
 	couchdb "github.com/timjacobi/go-couchdb"
 )
 
 // Client ...
+// A Client is safe for concurrent use by multiple goroutines.
 type Client struct {
-	Client   *couchdb.Client
-	username string
-	password string
+	Client           *couchdb.Client
+	username         string
+	password         string
+	useNumber        bool
+	idStrategy       IDStrategy
+	idField          string
+	maxConcurrency   int
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	hedgeDelay       time.Duration
+	retries          int
+	retryBudget      *retryBudget
+	retryIf          RetryPredicate
+	jsonMarshal      func(v interface{}) ([]byte, error)
+	jsonUnmarshal    func(data []byte, v interface{}) error
+	cache            *docCache
+	strictIndexes    bool
+	dryRun           *dryRunTransport
+	findAllLimit     int
+	header           http.Header
+	query            url.Values
+	base             *http.Transport
+	transport        http.RoundTripper
+	httpClient       *http.Client
 }
 
 // DB ...
+// A DB is safe for concurrent use by multiple goroutines: it is not
+// modified after creation, and each request is built separately.
 type DB struct {
 	*couchdb.DB
 	username string
 	password string
 	path     string
+	client   *Client
 }
 
+// Database is the set of operations available on a Cloudant database.
+// It is implemented by *DB, and can be used to substitute fakes in tests.
+type Database interface {
+	CreateDocument(doc interface{}) (string, string, error)
+	CreateDocumentWithID(id string, doc interface{}, rev string) (string, error)
+	DeleteDocument(id string, rev string) (string, error)
+	DeleteDocumentObj(doc map[string]interface{}) (string, error)
+	Rename(oldID, newID string, overwrite bool) (string, error)
+	Patch(id string, patch map[string]interface{}) (string, error)
+	NextSequence(counterID string) (int64, error)
+	UpdateDocument(id string, rev string, doc interface{}) (string, error)
+	PutRaw(id string, body json.RawMessage) (string, error)
+	GetDocument(id string, doc interface{}, opts Options) error
+	GetDocumentResp(id string, doc interface{}, opts Options) (*http.Response, error)
+	GetDocumentRev(id string) (string, error)
+	WaitForDocument(ctx context.Context, id string) (string, error)
+	GetDocumentWithRevisions(id string, doc interface{}, opts Options) (*Revisions, error)
+	GetDocumentMeta(id string, doc interface{}) (*DocumentMeta, error)
+	InvalidateCache(id string)
+	GetIfChanged(id, knownRev string, out interface{}) (bool, string, error)
+	GetAllDocument(result interface{}, opts Options) error
+	AllDocsByKeys(keys []string, includeDocs bool) ([]DocRow, error)
+	GetRevs(ids []string) (map[string]string, error)
+	AllDocsMultiQuery(queries []AllDocsQuery) ([][]DocRow, error)
+	Truncate(keepDesignDocs bool) (int, error)
+	AllDocsInPartition(partitionKey string, opts Options) ([]DocRow, error)
+	AllLocalDocs() ([]string, error)
+	LocalDocs(opts Options) ([]DocRow, error)
+	SearchDocument(query Query) ([]interface{}, error)
+	SetIndex(index Index) error
+	ListIndexes() ([]IndexInfo, error)
+	HasIndexFor(query Query) (bool, string, error)
+	EnsureIndexes(indexes []Index) ([]IndexResult, error)
+	CreateDesignDoc(name string, designJSON string) error
+	DeleteByQuery(query Query) (int, error)
+	ExpireOlderThan(field string, cutoff time.Time) (int, error)
+	Info() (*DBInfo, error)
+	Shards() (ShardMap, error)
+	BulkGet(refs []BulkGetRef, opts BulkGetOptions) ([]BulkGetResult, error)
+	EnsureDocuments(docs []IdentifiedDoc) ([]BulkResult, error)
+	BulkCreate(docs []interface{}, opts BulkOptions) ([]BulkResult, string, error)
+	NewBatchWriter(maxDocs int, maxInterval time.Duration) *BatchWriter
+	Import(ctx context.Context, r io.Reader, batchSize int, progress func(done, failed int)) (int, int, error)
+	FindOne(query Query, out interface{}) error
+	Count(query Query) (int, error)
+	FindEach(query Query, fn func(doc json.RawMessage) error) error
+	FindAll(query Query) ([]json.RawMessage, error)
+	Paginate(query Query, pageSize int) *Page
+	CreateDocumentWithAttachment(doc interface{}, name, contentType string, r io.Reader) (string, string, error)
+	GetAttachment(docID, name string, rng *ByteRange) (*AttachmentData, error)
+	GetAttachments(refs []AttachmentRef, concurrency int) (map[AttachmentRef][]byte, error)
+	ListAttachments(docID string) ([]AttachmentInfo, error)
+	GetRevsLimit() (int, error)
+	SetRevsLimit(n int) error
+	GetPurgedInfosLimit() (int, error)
+	SetPurgedInfosLimit(n int) error
+	GetSecurity() (*Security, error)
+	SetSecurity(security *Security) error
+	Changes(opts ChangesOptions) (*ChangesResp, error)
+	ContinuousChanges(opts ChangesOptions) *ChangesIterator
+	Watch(ctx context.Context, selector map[string]interface{}) (<-chan json.RawMessage, <-chan error)
+	ConsumeChanges(ctx context.Context, consumerID string, batchSize int, handler func([]ChangeRow) error) error
+	ChangedDocsSince(since string, fn func(doc json.RawMessage) error) (string, error)
+}
+
+var _ Database = (*DB)(nil)
+
 // DB returns the DB object without verifying its existence.
 func (c *Client) DB(name string) *DB {
+	return c.newDB(c.Client.DB(name), name)
+}
+
+func (c *Client) newDB(db *couchdb.DB, name string) *DB {
 	dbPath := c.Client.URL() + "/" + name
-	return &DB{c.Client.DB(name), c.username, c.password, dbPath}
+	return &DB{db, c.username, c.password, dbPath, c}
 }
 
 // Options ...
@@ -40,62 +146,262 @@ type Query struct {
 	Sort     []interface{}          `json:"sort,omitempty"`
 	Limit    int                    `json:"limit,omitempty"`
 	Skip     int                    `json:"skip,omitempty"`
+	Bookmark string                 `json:"bookmark,omitempty"`
+	// UseIndex is the index to use, as a design document name, or as a
+	// []string holding the design document and index names.
+	UseIndex interface{} `json:"use_index,omitempty"`
 }
 
 // Index query struct
 type Index struct {
 	Index struct {
-		Fields interface{} `json:"fields"`
+		// Fields lists the indexed fields. For a "text" index they are given
+		// as {"name": ..., "type": ...} objects, and may be left nil to index
+		// every field.
+		Fields interface{} `json:"fields,omitempty"`
+		// PartialFilterSelector restricts the index to the documents it
+		// matches. Such an index is only used by queries naming it in
+		// UseIndex, and their selectors must match a subset of it.
+		PartialFilterSelector map[string]interface{} `json:"partial_filter_selector,omitempty"`
 	} `json:"index"`
 	Name string `json:"name,omitempty"`
 	Type string `json:"type,omitempty"`
 	Ddoc string `json:"ddoc,omitempty"`
+	// Partitioned tells whether the index of a partitioned database is
+	// partitioned or global. It defaults to the partitioning of the database.
+	Partitioned *bool `json:"partitioned,omitempty"`
 }
 
 // NewClient ...
-func NewClient(username string, password string) (*Client, error) {
-	auth := couchdb.BasicAuth(username, password)
-	url := fmt.Sprintf("https://%s.cloudant.com", username)
-	couchClient, err := couchdb.NewClient(url, nil)
+func NewClient(username string, password string, opts ...ClientOption) (*Client, error) {
+	c := &Client{username: username, password: password}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.base = newTransport()
+	c.transport = c.base
+	if c.dryRun != nil {
+		c.dryRun.rt = c.transport
+		c.transport = c.dryRun
+	}
+	if c.header != nil || c.query != nil {
+		c.transport = &defaultsTransport{c.header, c.query, c.transport}
+	}
+	if c.maxConcurrency > 0 {
+		c.transport = &limitTransport{make(chan struct{}, c.maxConcurrency), c.transport}
+	}
+	if c.hedgeDelay > 0 {
+		c.transport = &hedgeTransport{c.hedgeDelay, c.transport}
+	}
+	if c.breakerThreshold > 0 {
+		c.transport = &breakerTransport{threshold: c.breakerThreshold, cooldown: c.breakerCooldown, rt: c.transport}
+	}
+	if c.retries > 0 {
+		c.transport = &retryTransport{c.retries, c.retryBudget, c.retryIf, c.transport}
+	}
+	c.httpClient = &http.Client{Transport: c.transport}
+	return c, c.connect()
+}
+
+// connect creates the couchdb client for the account of the client.
+func (c *Client) connect() error {
+	auth := couchdb.BasicAuth(c.username, c.password)
+	url := fmt.Sprintf("https://%s.cloudant.com", c.username)
+	couchClient, err := couchdb.NewClient(url, c.transport)
+	if err != nil {
+		return err
+	}
 	couchClient.SetAuth(auth)
-	return &Client{Client: couchClient, username: username, password: password}, err
+	c.Client = couchClient
+	return nil
+}
+
+// Credentials are the credentials of a Cloudant account.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// WithCredentials returns a copy of the client using other credentials. The
+// copy shares the transport of the client, with its connections and
+// options, so that many accounts can be served without a connection pool
+// for each. Closing either client closes the connections of both.
+func (c *Client) WithCredentials(creds Credentials) (*Client, error) {
+	clone := *c
+	clone.username = creds.Username
+	clone.password = creds.Password
+	if err := clone.connect(); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// Close closes the idle connections of the client. The client must not be
+// used after Close.
+func (c *Client) Close() error {
+	c.base.CloseIdleConnections()
+	return nil
 }
 
 // IsAlive check whether a server is alive.
 func (c *Client) IsAlive() error {
-	return c.Client.Ping()
+	return c.end(request.New().SetBasicAuth(c.username, c.password).Head(c.Client.URL()+"/"), nil)
+}
+
+// healthCheckConcurrency bounds the number of databases checked at once.
+const healthCheckConcurrency = 8
+
+// HealthCheck checks that the server is alive and that each database in
+// dbNames is reachable. The returned map holds the error for each database,
+// nil if it is reachable, or a *DatabaseNotFoundError if it doesn't exist.
+// The error is non-nil if the server is down.
+func (c *Client) HealthCheck(dbNames []string) (map[string]error, error) {
+	if err := c.IsAlive(); err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(dbNames))
+	sem := make(chan struct{}, healthCheckConcurrency)
+	for _, name := range dbNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// GET rather than HEAD, as the reason in the body of the
+			// response tells a missing database from other 404s.
+			err := c.end(request.New().SetBasicAuth(c.username, c.password).Get(c.Client.URL()+"/"+name), nil)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return results, nil
 }
 
 // CreateDB ensures that a database with the given name exists.
 func (c *Client) CreateDB(dbName string) (*DB, error) {
-	var db *couchdb.DB
-	var err error
-	if db, err = c.Client.CreateDB(dbName); err != nil {
+	if _, err := c.CreateDatabase(dbName); err != nil {
+		return nil, err
+	}
+	return c.DB(dbName), nil
+}
+
+// DBOperationResult is the result of creating or deleting a database.
+type DBOperationResult struct {
+	OK bool `json:"ok"`
+}
+
+// CreateDatabase creates a database. If it already exists, the error
+// satisfies IsDBExists.
+func (c *Client) CreateDatabase(name string) (DBOperationResult, error) {
+	var result DBOperationResult
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Put(c.Client.URL() + "/" + name)
+	err := c.end(req, &result)
+	return result, err
+}
+
+// DeleteDatabase deletes a database. If it doesn't exist, the error
+// satisfies IsNotFound.
+func (c *Client) DeleteDatabase(name string) (DBOperationResult, error) {
+	var result DBOperationResult
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Delete(c.Client.URL() + "/" + name)
+	err := c.end(req, &result)
+	return result, err
+}
+
+// dbReadyPollInterval is the interval at which CreateDBAndWait checks
+// whether a new database is ready.
+const dbReadyPollInterval = 200 * time.Millisecond
+
+// CreateDBAndWait creates a database, and waits until it is ready to serve
+// requests or ctx is done. Some clusters report a database as created
+// before all the nodes serve it.
+func (c *Client) CreateDBAndWait(ctx context.Context, name string) (*DB, error) {
+	db, err := c.CreateDB(name)
+	if err != nil {
 		return nil, err
 	}
-	dbPath := c.Client.URL() + "/" + dbName
-	return &DB{db, c.username, c.password, dbPath}, nil
+	for {
+		_, err := db.Info()
+		if err == nil {
+			return db, nil
+		}
+		if !IsNotFound(err) {
+			return nil, err
+		}
+		select {
+		case <-time.After(dbReadyPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 }
 
 // EnsureDB ensures that a database with the given name exists.
 func (c *Client) EnsureDB(name string) (*DB, error) {
-	var db *couchdb.DB
-	var err error
-	if db, err = c.Client.EnsureDB(name); err != nil {
+	if _, err := c.CreateDatabase(name); err != nil && !IsDBExists(err) {
 		return nil, err
 	}
-	dbPath := c.Client.URL() + "/" + name
-	return &DB{db, c.username, c.password, dbPath}, nil
+	return c.DB(name), nil
 }
 
 // DeleteDB ...
 func (c *Client) DeleteDB(dbName string) error {
-	return c.Client.DeleteDB(dbName)
+	_, err := c.DeleteDatabase(dbName)
+	return err
 }
 
 // CreateDocument ...
+// Documents without an _id get one from their id field, if set with
+// WithIDField, or else from the IDStrategy of the client.
 func (db *DB) CreateDocument(doc interface{}) (string, string, error) {
-	return db.Post(doc)
+	doc, err := db.marshal(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if db.client.idStrategy == nil && db.client.idField == "" {
+		return db.Post(doc)
+	}
+	fields, err := toMap(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := fields["_id"]; ok {
+		return db.Post(doc)
+	}
+	if value := fields[db.client.idField]; db.client.idField != "" && value != nil && value != "" {
+		fields["_id"] = fmt.Sprint(value)
+		return db.Post(fields)
+	}
+	if db.client.idStrategy == nil {
+		return db.Post(doc)
+	}
+	id, err := db.client.idStrategy(fields)
+	if err != nil {
+		return "", "", err
+	}
+	if id != "" {
+		fields["_id"] = id
+	}
+	return db.Post(fields)
+}
+
+// CreateDocumentWithID creates a document with the given id, and returns
+// its revision. A deleted document is recreated on top of its tombstone,
+// whose revision may be given as rev to continue that revision history.
+// Giving a rev for a document that doesn't exist results in a conflict,
+// returned as a *ConflictError.
+func (db *DB) CreateDocumentWithID(id string, doc interface{}, rev string) (string, error) {
+	return db.UpdateDocument(id, rev, doc)
 }
 
 // DeleteDocument ...
@@ -103,14 +409,150 @@ func (db *DB) DeleteDocument(id string, rev string) (string, error) {
 	return db.Delete(id, rev)
 }
 
+// DeleteDocumentObj deletes the document whose _id and _rev are given in doc.
+func (db *DB) DeleteDocumentObj(doc map[string]interface{}) (string, error) {
+	id, _ := doc["_id"].(string)
+	if id == "" {
+		return "", errors.New("Document has no _id")
+	}
+	rev, _ := doc["_rev"].(string)
+	if rev == "" {
+		return "", errors.New("Document has no _rev")
+	}
+	return db.Delete(id, rev)
+}
+
+// Rename moves the document oldID to newID, and returns the revision of
+// the new document. CouchDB has no atomic rename: the document is copied
+// with COPY, then the old one is deleted. If newID exists, a conflict is
+// returned unless overwrite is true, in which case it is replaced. If the
+// old document is changed in between, the copy is kept and the conflict
+// deleting it is returned.
+func (db *DB) Rename(oldID, newID string, overwrite bool) (string, error) {
+	oldRev, err := db.Rev(oldID)
+	if err != nil {
+		return "", err
+	}
+	destination := docPath(newID)
+	if overwrite {
+		destRev, err := db.Rev(newID)
+		if err != nil && !IsNotFound(err) {
+			return "", err
+		}
+		if destRev != "" {
+			destination += "?rev=" + destRev
+		}
+	}
+	req, err := http.NewRequest("COPY", db.path+"/"+docPath(oldID)+"?rev="+oldRev, nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(db.username, db.password)
+	req.Header.Set("Destination", destination)
+	resp, err := db.client.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := responseError(resp, body); err != nil {
+		return "", err
+	}
+	var data struct {
+		Rev string `json:"rev"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", err
+	}
+	if _, err := db.Delete(oldID, oldRev); err != nil {
+		return data.Rev, err
+	}
+	return data.Rev, nil
+}
+
 // UpdateDocument ...
+// On conflict, the error is a *ConflictError holding the current revision.
 func (db *DB) UpdateDocument(id string, rev string, doc interface{}) (string, error) {
-	return db.Put(id, doc, rev)
+	doc, err := db.marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	newRev, err := db.Put(id, doc, rev)
+	if err != nil {
+		return "", db.withCurrentRev(id, err)
+	}
+	return newRev, nil
+}
+
+// withCurrentRev turns a conflict error on document id into a
+// *ConflictError holding the current revision of the document.
+func (db *DB) withCurrentRev(id string, err error) error {
+	if couchErr, ok := err.(*couchdb.Error); ok && couchdb.Conflict(err) {
+		if current, revErr := db.Rev(id); revErr == nil {
+			return &ConflictError{couchErr, current}
+		}
+	}
+	return err
+}
+
+// PutRaw writes the JSON document body as is, without decoding it, and
+// returns the new revision. The body must hold the current _rev when
+// updating a document. Conflicts are returned as *ConflictError.
+func (db *DB) PutRaw(id string, body json.RawMessage) (string, error) {
+	var data struct {
+		Rev string `json:"rev"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Put(db.path + "/" + id)
+	req.BounceToRawString = true
+	req.SendString(string(body))
+	if err := db.client.end(req, &data); err != nil {
+		return "", db.withCurrentRev(id, err)
+	}
+	return data.Rev, nil
 }
 
 // GetDocument ...
+// With WithDocumentCache, documents requested without options are served
+// from the cache when the server reports them unchanged.
 func (db *DB) GetDocument(id string, doc interface{}, opts Options) error {
-	return db.Get(id, doc, couchdb.Options(opts))
+	if db.client.cache != nil && len(opts) == 0 {
+		return db.getCached(id, doc)
+	}
+	if !db.client.useNumber && db.client.jsonUnmarshal == nil {
+		return db.Get(id, doc, couchdb.Options(opts))
+	}
+	var raw json.RawMessage
+	if err := db.Get(id, &raw, couchdb.Options(opts)); err != nil {
+		return err
+	}
+	return db.unmarshal(raw, doc)
+}
+
+// GetDocumentResp decodes the document into doc like GetDocument, and also
+// returns the HTTP response, for reading headers such as
+// X-Cloudant-Request-Class. The body of the response can be read again,
+// and must be closed by the caller.
+func (db *DB) GetDocumentResp(id string, doc interface{}, opts Options) (*http.Response, error) {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/" + id)
+	if err := setOptions(req, opts); err != nil {
+		return nil, err
+	}
+	resp, body, err := db.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := responseError(resp, body); err != nil {
+		return resp, err
+	}
+	return resp, db.unmarshal(body, doc)
 }
 
 // GetDocumentRev gets the current document revision.
@@ -118,26 +560,117 @@ func (db *DB) GetDocumentRev(id string) (string, error) {
 	return db.Rev(id)
 }
 
+// waitMaxDelay caps the delay between the checks of WaitForDocument.
+const waitMaxDelay = 5 * time.Second
+
+// WaitForDocument waits until the document exists, and returns its
+// revision. It checks for the document with backoff, up to waitMaxDelay
+// between checks, until it is found or ctx is done. A missing database is
+// waited for as well, as with a replication target being created.
+func (db *DB) WaitForDocument(ctx context.Context, id string) (string, error) {
+	delay := retryBaseDelay
+	for {
+		rev, err := db.Rev(id)
+		if err == nil {
+			return rev, nil
+		}
+		if !IsNotFound(err) {
+			return "", err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if delay *= 2; delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
+
+// GetIfChanged decodes the document into out only if its current revision
+// differs from knownRev, using a conditional request. When the document is
+// unchanged, changed is false and the body is not transferred.
+func (db *DB) GetIfChanged(id, knownRev string, out interface{}) (changed bool, newRev string, err error) {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path+"/"+id).
+		Set("If-None-Match", `"`+knownRev+`"`)
+	resp, body, err := db.client.send(req)
+	if err != nil {
+		return false, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return false, knownRev, nil
+	}
+	if err := responseError(resp, body); err != nil {
+		return false, "", err
+	}
+	if err := db.unmarshal(body, out); err != nil {
+		return false, "", err
+	}
+	return true, strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
 // GetAllDocument ...
 func (db *DB) GetAllDocument(result interface{}, opts Options) error {
 	return db.AllDocs(result, couchdb.Options(opts))
 }
 
+// DBInfo ...
+type DBInfo struct {
+	DBName      string `json:"db_name"`
+	DocCount    int    `json:"doc_count"`
+	DocDelCount int    `json:"doc_del_count"`
+	UpdateSeq   Seq    `json:"update_seq"`
+	Sizes       struct {
+		File     int64 `json:"file"`
+		External int64 `json:"external"`
+		Active   int64 `json:"active"`
+	} `json:"sizes"`
+}
+
+// Info returns information about the database.
+func (db *DB) Info() (*DBInfo, error) {
+	info := &DBInfo{}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path)
+	if err := db.client.end(req, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 // SearchDocument ...
 func (db *DB) SearchDocument(query Query) (result []interface{}, err error) {
+	if err := db.checkQuery(query); err != nil {
+		return nil, err
+	}
 	req := request.New()
 	path := "/_find"
 
 	var data struct {
-		Docs     []interface{}
+		Docs     json.RawMessage
 		Bookmark string `json:"bookmark"`
 	}
-	_, _, errs := req.SetBasicAuth(db.username, db.password).Post(db.path + path).Send(query).EndStruct(&data)
-
-	if errs != nil {
-		return nil, errs[0]
+	resp, body, err := db.client.send(req.SetBasicAuth(db.username, db.password).Post(db.path + path).Send(query))
+	if err != nil {
+		return nil, err
 	}
-	return data.Docs, nil
+	if err := responseError(resp, body); err != nil {
+		return nil, bookmarkError(err, query.Bookmark)
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Docs) == 0 {
+		return nil, nil
+	}
+	if err := db.unmarshal(data.Docs, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // SetIndex ...
@@ -145,9 +678,9 @@ func (db *DB) SetIndex(index Index) error {
 	req := request.New()
 	path := "/_index"
 
-	resp, _, errs := req.SetBasicAuth(db.username, db.password).Post(db.path + path).Send(index).End()
-	if errs != nil {
-		return errs[0]
+	resp, _, err := db.client.send(req.SetBasicAuth(db.username, db.password).Post(db.path + path).Send(index))
+	if err != nil {
+		return err
 	}
 	if resp.StatusCode >= 400 {
 		return errors.New("Error in setting index: " + strconv.Itoa(resp.StatusCode))
@@ -164,9 +697,12 @@ func (db *DB) CreateDesignDoc(name string, designJSON string) error {
 	}
 	req := request.New()
 	path := "/_design/" + name
-	_, _, errs := req.SetBasicAuth(db.username, db.password).Put(db.path + path).SendString(designJSON).EndStruct(&data)
-	if errs != nil {
-		return errs[0]
+	_, body, err := db.client.send(req.SetBasicAuth(db.username, db.password).Put(db.path + path).SendString(designJSON))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return err
 	}
 	if data.Ok != true {
 		return errors.New("Error in creating design doc")
@@ -217,8 +753,15 @@ func (ddoc *DesignDocument) Search(db *DB, index, query, bookmark string, limit
 	if bookmark != "" {
 		req = req.Query("bookmark=" + bookmark)
 	}
-	if _, _, errs := req.EndStruct(body); errs != nil {
-		return nil, errs[len(errs)-1]
+	resp, data, err := db.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp, data); err != nil {
+		return nil, bookmarkError(err, bookmark)
+	}
+	if err := json.Unmarshal(data, body); err != nil {
+		return nil, err
 	}
 	return body, nil
 }
@@ -238,8 +781,25 @@ func (ddoc *DesignDocument) View(db *DB, view string) (*ViewResp, error) {
 	req := request.New().
 		SetBasicAuth(db.username, db.password).
 		Get(db.path + path)
-	if _, _, errs := req.EndStruct(body); errs != nil {
-		return nil, errs[len(errs)-1]
+	_, data, err := db.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, body); err != nil {
+		return nil, err
 	}
 	return body, nil
 }
+
+// BuildIndex triggers the build of the index of a view without waiting for
+// it to complete, so that the first query after a deployment doesn't pay
+// for indexing. It returns once the build has started.
+func (ddoc *DesignDocument) BuildIndex(db *DB, view string) error {
+	path := "/" + ddoc.ID + "/_view/" + view
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path+path).
+		Param("limit", "0").
+		Param("stale", "update_after")
+	return db.client.end(req, nil)
+}
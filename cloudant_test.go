@@ -1,12 +1,22 @@
 package cloudant
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	request "github.com/parnurzeal/gorequest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,6 +28,19 @@ const testDBName = "test_db"
 var testClient *Client
 var testDB *DB
 
+const partitionedDBName = "test_db_partitioned"
+
+// createPartitionedDB creates an empty partitioned test DB.
+func createPartitionedDB(t *testing.T) *DB {
+	testClient.DeleteDB(partitionedDBName)
+	req := request.New().
+		SetBasicAuth(username, password).
+		Put(testClient.Client.URL()+"/"+partitionedDBName).
+		Param("partitioned", "true")
+	assert.NoError(t, testClient.end(req, nil), "Error creating partitioned DB")
+	return testClient.DB(partitionedDBName)
+}
+
 func TestMain(m *testing.M) {
 	// Create the test client
 	var err error
@@ -39,6 +62,14 @@ func TestConnection(t *testing.T) {
 	assert.NoError(t, err, "Error connecting to cloudant")
 }
 
+func TestHealthCheck(t *testing.T) {
+	t.Log("Testing health check of databases")
+	results, err := testClient.HealthCheck([]string{"_replicator", "missing_db"})
+	assert.NoError(t, err, "Error connecting to cloudant")
+	assert.NoError(t, results["_replicator"])
+	assert.True(t, IsNotFound(results["missing_db"]))
+}
+
 func TestDeleteDB(t *testing.T) {
 	t.Log("Testing DB delete")
 	err := testClient.DeleteDB(testDBName)
@@ -120,6 +151,45 @@ func TestDocumentCRUDStruct(t *testing.T) {
 	assert.NoError(t, err, "Error deleting document with struct")
 }
 
+func TestUpdateDocumentConflict(t *testing.T) {
+	t.Log("Testing doc update conflict")
+	testData := map[string]string{"name": "test-conflict"}
+	id, rev, err := testDB.CreateDocument(testData)
+	assert.NoError(t, err)
+	newRev, err := testDB.UpdateDocument(id, rev, testData)
+	assert.NoError(t, err)
+
+	_, err = testDB.UpdateDocument(id, rev, testData)
+	assert.True(t, IsConflict(err), "Expected conflict error")
+	conflict, ok := err.(*ConflictError)
+	assert.True(t, ok)
+	assert.Equal(t, newRev, conflict.Rev)
+
+	_, err = testDB.UpdateDocument(id, conflict.Rev, testData)
+	assert.NoError(t, err)
+}
+
+func TestGetIfChanged(t *testing.T) {
+	t.Log("Testing conditional doc get")
+	testData := map[string]string{"name": "test-etag"}
+	id, rev, err := testDB.CreateDocument(testData)
+	assert.NoError(t, err)
+
+	resultData := make(map[string]string)
+	changed, newRev, err := testDB.GetIfChanged(id, rev, &resultData)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, rev, newRev)
+
+	updatedRev, err := testDB.UpdateDocument(id, rev, testData)
+	assert.NoError(t, err)
+	changed, newRev, err = testDB.GetIfChanged(id, rev, &resultData)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, updatedRev, newRev)
+	assert.Equal(t, "test-etag", resultData["name"])
+}
+
 func TestSetIndex(t *testing.T) {
 	t.Log("Testing setting index for DB")
 	index := Index{}
@@ -191,6 +261,13 @@ func TestGetView(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestBuildIndex(t *testing.T) {
+	t.Log("Testing triggering view index build")
+	ddoc := NewDesignDocument("example")
+	err := ddoc.BuildIndex(testDB, "foo")
+	assert.NoError(t, err)
+}
+
 func TestSearchInDesignDoc(t *testing.T) {
 	t.Log("Testing searching index defined in design doc")
 	filePath := filepath.Join("test-fixtures", "search_test.json")
@@ -203,3 +280,1544 @@ func TestSearchInDesignDoc(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, resp.Num)
 }
+
+func TestDeleteByQuery(t *testing.T) {
+	t.Log("Testing delete documents by query")
+	type data struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	for i := 0; i < 3; i++ {
+		_, _, err := testDB.CreateDocument(&data{ID: "delete", Name: "test-delete"})
+		assert.NoError(t, err)
+	}
+
+	query := Query{}
+	query.Selector = map[string]interface{}{"name": "test-delete"}
+	deleted, err := testDB.DeleteByQuery(query)
+	assert.NoError(t, err, "Error deleting documents by query")
+	assert.Equal(t, 3, deleted)
+
+	result, err := testDB.SearchDocument(query)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestFindOne(t *testing.T) {
+	t.Log("Testing find one document")
+	query := Query{}
+	query.Selector = map[string]interface{}{"id": "111"}
+	var result struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	err := testDB.FindOne(query, &result)
+	assert.NoError(t, err, "Error finding document")
+	assert.Equal(t, "test3-3", result.Name)
+
+	query.Selector = map[string]interface{}{"id": "missing"}
+	err = testDB.FindOne(query, &result)
+	assert.True(t, IsNotFound(err), "Expected not_found error")
+}
+
+func TestCount(t *testing.T) {
+	t.Log("Testing count documents")
+	query := Query{}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test3-"}}
+	count, err := testDB.Count(query)
+	assert.NoError(t, err, "Error counting documents")
+	assert.Equal(t, 3, count)
+}
+
+func TestAttachInline(t *testing.T) {
+	t.Log("Testing doc create with inline attachment")
+	doc := map[string]interface{}{"name": "test-attachment"}
+	AttachInline(doc, "hello.txt", "text/plain", []byte("hello"))
+	id, _, err := testDB.CreateDocument(doc)
+	assert.NoError(t, err, "Error creating document with inline attachment")
+
+	var result struct {
+		Attachments map[string]struct {
+			ContentType string `json:"content_type"`
+			Data        string `json:"data"`
+		} `json:"_attachments"`
+	}
+	err = testDB.GetDocument(id, &result, Options{"attachments": true})
+	assert.NoError(t, err)
+	attachment := result.Attachments["hello.txt"]
+	assert.Equal(t, "text/plain", attachment.ContentType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hello")), attachment.Data)
+}
+
+func TestCreateDocumentWithAttachment(t *testing.T) {
+	t.Log("Testing doc create with multipart attachment")
+	doc := map[string]interface{}{"name": "test-multipart"}
+	id, rev, err := testDB.CreateDocumentWithAttachment(doc, "hello.txt", "text/plain", strings.NewReader("hello"))
+	assert.NoError(t, err, "Error creating document with attachment")
+	assert.NotEmpty(t, id)
+	assert.NotEmpty(t, rev)
+
+	att, err := testDB.Attachment(id, "hello.txt", rev)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(att.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestGetDocumentWithRevisions(t *testing.T) {
+	t.Log("Testing doc get with revisions")
+	testData := map[string]string{"name": "test-revs"}
+	id, rev, err := testDB.CreateDocument(testData)
+	assert.NoError(t, err)
+	newRev, err := testDB.UpdateDocument(id, rev, testData)
+	assert.NoError(t, err)
+
+	resultData := make(map[string]interface{})
+	revs, err := testDB.GetDocumentWithRevisions(id, &resultData, Options{})
+	assert.NoError(t, err, "Error getting document with revisions")
+	assert.Equal(t, "test-revs", resultData["name"])
+	assert.Equal(t, 2, revs.Start)
+	assert.Equal(t, []string{newRev, rev}, revs.Revs())
+}
+
+func TestPullReplicate(t *testing.T) {
+	t.Log("Testing pull replication")
+	const replicaName = "test_db_replica"
+	doc := map[string]interface{}{"name": "test-replicate-attachment"}
+	AttachInline(doc, "hello.txt", "text/plain", []byte("hello"))
+	attID, _, err := testDB.CreateDocument(doc)
+	assert.NoError(t, err)
+	err = testClient.PullReplicate(testDBName, testClient, replicaName, ReplicateOptions{BatchSize: 2})
+	assert.NoError(t, err, "Error replicating DB")
+
+	var source, replica struct {
+		Num int `json:"total_rows"`
+	}
+	assert.NoError(t, testDB.GetAllDocument(&source, Options{}))
+	assert.NoError(t, testClient.DB(replicaName).GetAllDocument(&replica, Options{}))
+	assert.Equal(t, source.Num, replica.Num)
+
+	att, err := testClient.DB(replicaName).GetAttachment(attID, "hello.txt", nil)
+	if assert.NoError(t, err, "Attachment should be replicated") {
+		data, _ := ioutil.ReadAll(att.Body)
+		att.Body.Close()
+		assert.Equal(t, "hello", string(data))
+	}
+
+	// A second run resumes from the checkpoint and finds nothing to do.
+	err = testClient.PullReplicate(testDBName, testClient, replicaName, ReplicateOptions{BatchSize: 2})
+	assert.NoError(t, err)
+
+	assert.NoError(t, testClient.DeleteDB(replicaName))
+}
+
+func TestUseNumber(t *testing.T) {
+	t.Log("Testing decoding numbers as json.Number")
+	client, err := NewClient(username, password, WithUseNumber())
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	const bigID = "9007199254740993"
+	doc := map[string]interface{}{"number": json.Number(bigID)}
+	id, _, err := db.CreateDocument(doc)
+	assert.NoError(t, err)
+
+	result := make(map[string]interface{})
+	err = db.GetDocument(id, &result, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number(bigID), result["number"])
+
+	query := Query{}
+	query.Selector = map[string]interface{}{"_id": id}
+	docs, err := db.SearchDocument(query)
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number(bigID), docs[0].(map[string]interface{})["number"])
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	t.Log("Testing concurrency-limited client")
+	client, err := NewClient(username, password, WithMaxConcurrency(2))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := db.CreateDocument(map[string]string{"name": "test-concurrency"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestDefaultHeaderAndQueryParam(t *testing.T) {
+	t.Log("Testing default headers and query parameters")
+	client, err := NewClient(username, password,
+		WithDefaultHeader("X-Cloudant-User", username),
+		WithDefaultQueryParam("conflicts", "true"))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	id, _, err := db.CreateDocument(map[string]string{"name": "test-defaults"})
+	assert.NoError(t, err)
+	result := make(map[string]interface{})
+	err = db.GetDocument(id, &result, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-defaults", result["name"])
+}
+
+func TestRevsLimit(t *testing.T) {
+	t.Log("Testing revs limit")
+	err := testDB.SetRevsLimit(500)
+	assert.NoError(t, err, "Error setting revs limit")
+	limit, err := testDB.GetRevsLimit()
+	assert.NoError(t, err, "Error getting revs limit")
+	assert.Equal(t, 500, limit)
+}
+
+func TestListIndexes(t *testing.T) {
+	t.Log("Testing listing indexes")
+	indexes, err := testDB.ListIndexes()
+	assert.NoError(t, err, "Error listing indexes")
+	assert.NotEmpty(t, indexes)
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	t.Log("Testing ensuring indexes")
+	index := Index{Name: "by-name"}
+	index.Index.Fields = []string{"name"}
+	results, err := testDB.EnsureIndexes([]Index{index})
+	assert.NoError(t, err, "Error ensuring indexes")
+	assert.Equal(t, []IndexResult{{Name: "by-name", Created: true}}, results)
+
+	results, err = testDB.EnsureIndexes([]Index{index})
+	assert.NoError(t, err, "Error ensuring indexes")
+	assert.Equal(t, []IndexResult{{Name: "by-name", Created: false}}, results)
+}
+
+func TestChanges(t *testing.T) {
+	t.Log("Testing changes feed")
+	changes, err := testDB.Changes(ChangesOptions{Limit: 2})
+	assert.NoError(t, err, "Error getting changes")
+	assert.Len(t, changes.Results, 2)
+	assert.NotEmpty(t, changes.LastSeq)
+}
+
+func TestContinuousChangesHeartbeat(t *testing.T) {
+	t.Log("Testing continuous changes feed with heartbeat")
+	changes, err := testDB.Changes(ChangesOptions{Since: "now"})
+	assert.NoError(t, err)
+	id, _, err := testDB.CreateDocument(map[string]string{"name": "test-changes"})
+	assert.NoError(t, err)
+
+	it := testDB.ContinuousChanges(ChangesOptions{Since: string(changes.LastSeq), Heartbeat: time.Second})
+	defer it.Close()
+	for it.Next() {
+		if it.Row().ID == id {
+			break
+		}
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, id, it.Row().ID)
+}
+
+func TestChangesSelector(t *testing.T) {
+	t.Log("Testing changes feed filtered by selector")
+	selector := map[string]interface{}{"name": "test-changes"}
+	changes, err := testDB.Changes(ChangesOptions{Selector: selector, IncludeDocs: true})
+	assert.NoError(t, err, "Error getting filtered changes")
+	assert.NotEmpty(t, changes.Results)
+	for _, row := range changes.Results {
+		var doc map[string]interface{}
+		assert.NoError(t, json.Unmarshal(row.Doc, &doc))
+		assert.Equal(t, "test-changes", doc["name"])
+	}
+}
+
+func TestChangesSeqInterval(t *testing.T) {
+	t.Log("Testing changes feed with seq interval")
+	changes, err := testDB.Changes(ChangesOptions{SeqInterval: 100, Limit: 5})
+	assert.NoError(t, err, "Error getting changes")
+	assert.Len(t, changes.Results, 5)
+	assert.NotEmpty(t, changes.LastSeq)
+}
+
+func TestBulkCreate(t *testing.T) {
+	t.Log("Testing bulk create")
+	docs := []interface{}{
+		map[string]string{"name": "test-bulk-1"},
+		map[string]string{"name": "test-bulk-2"},
+	}
+	results, seq, err := testDB.BulkCreate(docs, BulkOptions{ReturnSeq: true})
+	assert.NoError(t, err, "Error creating documents in bulk")
+	assert.Len(t, results, 2)
+	for _, result := range results {
+		assert.Empty(t, result.Error)
+		assert.NotEmpty(t, result.Rev)
+	}
+	assert.NotEmpty(t, seq)
+
+	changes, err := testDB.Changes(ChangesOptions{Since: seq})
+	assert.NoError(t, err)
+	for _, row := range changes.Results {
+		assert.NotEqual(t, results[0].ID, row.ID)
+	}
+}
+
+func TestAllDocsMultiQuery(t *testing.T) {
+	t.Log("Testing multiple queries on all docs")
+	queries := []AllDocsQuery{
+		{Limit: 1},
+		{StartKey: "_design/", EndKey: "_design0", IncludeDocs: true},
+	}
+	rows, err := testDB.AllDocsMultiQuery(queries)
+	assert.NoError(t, err, "Error querying all docs")
+	assert.Len(t, rows, 2)
+	assert.Len(t, rows[0], 1)
+	assert.NotEmpty(t, rows[1])
+	for _, row := range rows[1] {
+		assert.Contains(t, row.ID, "_design/")
+		assert.NotEmpty(t, row.Doc)
+	}
+}
+
+func TestViewMultiQuery(t *testing.T) {
+	t.Log("Testing multiple queries on a view")
+	ddoc := NewDesignDocument("example")
+	queries := []ViewOptions{
+		{Key: "1"},
+		{Key: "11"},
+		{Limit: 2},
+	}
+	results, err := ddoc.ViewMultiQuery(testDB, "foo", queries)
+	assert.NoError(t, err, "Error querying view")
+	assert.Len(t, results, 3)
+	assert.NotEmpty(t, results[1].Rows)
+	assert.Len(t, results[2].Rows, 2)
+}
+
+func TestAllDocsInPartition(t *testing.T) {
+	t.Log("Testing all docs in a partition")
+	db := createPartitionedDB(t)
+
+	for _, id := range []string{"a:1", "a:2", "b:1"} {
+		_, err := db.UpdateDocument(id, "", map[string]string{"name": id})
+		assert.NoError(t, err)
+	}
+	rows, err := db.AllDocsInPartition("a", Options{"include_docs": true})
+	assert.NoError(t, err, "Error getting all docs in partition")
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "a:1", rows[0].ID)
+	assert.NotEmpty(t, rows[0].Doc)
+
+	assert.NoError(t, testClient.DeleteDB(partitionedDBName))
+}
+
+func TestSetIndexPartitioned(t *testing.T) {
+	t.Log("Testing setting global index on partitioned DB")
+	db := createPartitionedDB(t)
+	partitioned := false
+	index := Index{Name: "global-name", Partitioned: &partitioned}
+	index.Index.Fields = []string{"name"}
+	assert.NoError(t, db.SetIndex(index), "Error setting global index")
+
+	indexes, err := db.ListIndexes()
+	assert.NoError(t, err)
+	found := false
+	for _, info := range indexes {
+		found = found || info.Name == "global-name"
+	}
+	assert.True(t, found)
+	assert.NoError(t, testClient.DeleteDB(partitionedDBName))
+}
+
+func TestClose(t *testing.T) {
+	t.Log("Testing closing a client")
+	client, err := NewClient(username, password)
+	assert.NoError(t, err)
+	assert.NoError(t, client.IsAlive())
+	assert.NoError(t, client.Close())
+}
+
+func TestGetAttachmentRange(t *testing.T) {
+	t.Log("Testing attachment get with range")
+	doc := map[string]interface{}{"name": "test-range"}
+	id, _, err := testDB.CreateDocumentWithAttachment(doc, "digits.txt", "text/plain", strings.NewReader("0123456789"))
+	assert.NoError(t, err)
+
+	att, err := testDB.GetAttachment(id, "digits.txt", &ByteRange{Start: 2, End: 4})
+	assert.NoError(t, err, "Error getting attachment range")
+	defer att.Body.Close()
+	data, err := ioutil.ReadAll(att.Body)
+	assert.NoError(t, err)
+	assert.True(t, att.Partial)
+	assert.Equal(t, "bytes", att.AcceptRanges)
+	assert.Equal(t, int64(3), att.ContentLength)
+	assert.Equal(t, "234", string(data))
+}
+
+func TestExpireOlderThan(t *testing.T) {
+	t.Log("Testing expiring old documents")
+	now := time.Now().UTC()
+	docs := []interface{}{
+		map[string]string{"name": "test-expire", "created": now.Add(-48 * time.Hour).Format(time.RFC3339)},
+		map[string]string{"name": "test-expire", "created": now.Add(-47 * time.Hour).Format(time.RFC3339)},
+		map[string]string{"name": "test-expire", "created": now.Format(time.RFC3339)},
+	}
+	_, _, err := testDB.BulkCreate(docs, BulkOptions{})
+	assert.NoError(t, err)
+
+	removed, err := testDB.ExpireOlderThan("created", now.Add(-24*time.Hour))
+	assert.NoError(t, err, "Error expiring documents")
+	assert.Equal(t, 2, removed)
+}
+
+func TestSearchInto(t *testing.T) {
+	t.Log("Testing search decoding into structs")
+	type data struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	ddoc := NewDesignDocument("search_test")
+	var result []data
+	bookmark, err := ddoc.SearchInto(testDB, "byField", "id:\"111\"", SearchOptions{Limit: 10}, &result)
+	assert.NoError(t, err, "Error searching into structs")
+	assert.NotEmpty(t, bookmark)
+	assert.Equal(t, []data{{ID: "111", Name: "test3-3"}}, result)
+}
+
+func TestSearchDocumentUseIndex(t *testing.T) {
+	t.Log("Testing search documents with a specific index")
+	index := Index{Name: "by-id-name", Ddoc: "test-use-index"}
+	index.Index.Fields = []string{"id", "name"}
+	assert.NoError(t, testDB.SetIndex(index))
+
+	query := Query{UseIndex: []string{"test-use-index", "by-id-name"}}
+	query.Selector = map[string]interface{}{"id": "11"}
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"use_index":["test-use-index","by-id-name"]`)
+
+	result, err := testDB.SearchDocument(query)
+	assert.NoError(t, err, "Error searching documents with index")
+	assert.Len(t, result, 1)
+
+	query.UseIndex = "test-use-index"
+	result, err = testDB.SearchDocument(query)
+	assert.NoError(t, err, "Error searching documents with design doc")
+	assert.Len(t, result, 1)
+}
+
+func TestShards(t *testing.T) {
+	t.Log("Testing getting shard map")
+	shards, err := testDB.Shards()
+	assert.NoError(t, err, "Error getting shards")
+	assert.NotEmpty(t, shards.ByRange)
+	assert.NotEmpty(t, shards.ByNode)
+}
+
+func TestChangedDocsSince(t *testing.T) {
+	t.Log("Testing changed docs since a sequence")
+	changes, err := testDB.Changes(ChangesOptions{Since: "now"})
+	assert.NoError(t, err)
+	id, rev, err := testDB.CreateDocument(map[string]string{"name": "test-changed-docs"})
+	assert.NoError(t, err)
+	_, err = testDB.DeleteDocument(id, rev)
+	assert.NoError(t, err)
+
+	var docs []map[string]interface{}
+	since, err := testDB.ChangedDocsSince(string(changes.LastSeq), func(doc json.RawMessage) error {
+		var fields map[string]interface{}
+		err := json.Unmarshal(doc, &fields)
+		docs = append(docs, fields)
+		return err
+	})
+	assert.NoError(t, err, "Error getting changed docs")
+	assert.NotEmpty(t, since)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, id, docs[0]["_id"])
+	assert.Equal(t, true, docs[0]["_deleted"])
+}
+
+func TestIDStrategy(t *testing.T) {
+	t.Log("Testing doc create with id strategy")
+	client, err := NewClient(username, password, WithIDStrategy(FieldStrategy("code")))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	id, _, err := db.CreateDocument(map[string]string{"code": "natural-key"})
+	assert.NoError(t, err)
+	assert.Equal(t, "natural-key", id)
+
+	id, _, err = db.CreateDocument(map[string]string{"_id": "explicit-id", "code": "other-key"})
+	assert.NoError(t, err)
+	assert.Equal(t, "explicit-id", id)
+
+	_, _, err = db.CreateDocument(map[string]string{"name": "no-code"})
+	assert.Error(t, err)
+}
+
+func TestGetDocumentMeta(t *testing.T) {
+	t.Log("Testing doc get with meta")
+	id, rev, err := testDB.CreateDocument(map[string]string{"name": "test-meta"})
+	assert.NoError(t, err)
+	conflict := map[string]interface{}{
+		"_id":        id,
+		"_revisions": map[string]interface{}{"start": 1, "ids": []string{"abc"}},
+		"_rev":       "1-abc",
+		"name":       "test-meta-conflict",
+	}
+	req := request.New().
+		SetBasicAuth(username, password).
+		Post(testDB.path + "/_bulk_docs").
+		Send(map[string]interface{}{"docs": []interface{}{conflict}, "new_edits": false})
+	assert.NoError(t, testClient.end(req, nil))
+
+	resultData := make(map[string]interface{})
+	meta, err := testDB.GetDocumentMeta(id, &resultData)
+	assert.NoError(t, err, "Error getting document meta")
+	assert.Len(t, meta.Conflicts, 1)
+	assert.Contains(t, []string{rev, "1-abc"}, meta.Conflicts[0])
+	assert.NotEmpty(t, meta.RevsInfo)
+}
+
+func TestViewReduceCounts(t *testing.T) {
+	t.Log("Testing reduce view counts")
+	filePath := filepath.Join("test-fixtures", "reduce_test.json")
+	file, _ := ioutil.ReadFile(filePath)
+	err := testDB.CreateDesignDoc("reduce_test", string(file))
+	assert.NoError(t, err)
+
+	ddoc := NewDesignDocument("reduce_test")
+	counts, err := ddoc.ViewReduceCounts(testDB, "count_by_name", 0)
+	assert.NoError(t, err, "Error getting reduce view counts")
+	assert.Equal(t, float64(1), counts["test3-3"])
+
+	_, err = ddoc.ViewReduceCounts(testDB, "stats_by_name", 0)
+	assert.Error(t, err, "Unexpected success with non-numeric values")
+}
+
+func TestPutRaw(t *testing.T) {
+	t.Log("Testing raw doc put")
+	rev, err := testDB.PutRaw("test-raw", json.RawMessage(`{"name":"test-raw","big":12345678901234567890}`))
+	assert.NoError(t, err, "Error putting raw document")
+	assert.NotEmpty(t, rev)
+
+	_, err = testDB.PutRaw("test-raw", json.RawMessage(`{"name":"test-raw-conflict"}`))
+	assert.True(t, IsConflict(err), "Expected conflict error")
+
+	newRev, err := testDB.PutRaw("test-raw", json.RawMessage(`{"_rev":"`+rev+`","name":"test-raw-2"}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, rev, newRev)
+}
+
+func TestSearchDocumentText(t *testing.T) {
+	t.Log("Testing search documents with a text index")
+	_, _, err := testDB.CreateDocument(map[string]string{"name": "test-text", "title": "quick brown fox"})
+	assert.NoError(t, err)
+
+	index := Index{Name: "by-title-text", Type: "text", Ddoc: "test-text-index"}
+	index.Index.Fields = []map[string]string{{"name": "title", "type": "string"}}
+	assert.NoError(t, testDB.SetIndex(index), "Error setting text index")
+
+	query := Query{Selector: map[string]interface{}{"$text": "brown fox"}}
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"selector":{"$text":"brown fox"}`)
+
+	result, err := testDB.SearchDocument(query)
+	assert.NoError(t, err, "Error searching documents with $text")
+	assert.Len(t, result, 1)
+	assert.Equal(t, "test-text", result[0].(map[string]interface{})["name"])
+}
+
+func TestGetAttachments(t *testing.T) {
+	t.Log("Testing batch attachment get")
+	var refs []AttachmentRef
+	for _, content := range []string{"first", "second", "third"} {
+		doc := map[string]interface{}{"name": "test-attachments"}
+		id, _, err := testDB.CreateDocumentWithAttachment(doc, "content.txt", "text/plain", strings.NewReader(content))
+		assert.NoError(t, err)
+		refs = append(refs, AttachmentRef{id, "content.txt"})
+	}
+	missing := AttachmentRef{refs[0].DocID, "missing.txt"}
+
+	results, err := testDB.GetAttachments(append(refs, missing), 2)
+	assert.Error(t, err, "Expected error for missing attachment")
+	attErr, ok := err.(*AttachmentsError)
+	assert.True(t, ok)
+	assert.Len(t, attErr.Errors, 1)
+	assert.True(t, IsNotFound(attErr.Errors[missing]))
+	assert.Len(t, results, 3)
+	assert.Equal(t, "second", string(results[refs[1]]))
+}
+
+func TestDeleteDocumentObj(t *testing.T) {
+	t.Log("Testing doc delete with document object")
+	id, _, err := testDB.CreateDocument(map[string]string{"name": "test-delete-obj"})
+	assert.NoError(t, err)
+	doc := make(map[string]interface{})
+	assert.NoError(t, testDB.GetDocument(id, &doc, Options{}))
+
+	_, err = testDB.DeleteDocumentObj(map[string]interface{}{"_id": id})
+	assert.Error(t, err, "Unexpected delete success without _rev")
+
+	_, err = testDB.DeleteDocumentObj(doc)
+	assert.NoError(t, err, "Error deleting document with object")
+	err = testDB.GetDocument(id, &doc, Options{})
+	assert.True(t, IsNotFound(err))
+}
+
+func TestPatch(t *testing.T) {
+	t.Log("Testing doc patch")
+	doc := map[string]interface{}{
+		"name":  "test-patch",
+		"owner": map[string]interface{}{"name": "x", "email": "x@example.com"},
+	}
+	id, rev, err := testDB.CreateDocument(doc)
+	assert.NoError(t, err)
+
+	newRev, err := testDB.Patch(id, map[string]interface{}{
+		"owner": map[string]interface{}{"email": "y@example.com"},
+	})
+	assert.NoError(t, err, "Error patching document")
+	assert.NotEqual(t, rev, newRev)
+
+	resultData := make(map[string]interface{})
+	assert.NoError(t, testDB.GetDocument(id, &resultData, Options{}))
+	assert.Equal(t, "test-patch", resultData["name"])
+	assert.Equal(t, map[string]interface{}{"name": "x", "email": "y@example.com"}, resultData["owner"])
+}
+
+func TestFindEach(t *testing.T) {
+	t.Log("Testing streaming search documents")
+	query := Query{Limit: 2}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test3-"}}
+	var names []string
+	err := testDB.FindEach(query, func(doc json.RawMessage) error {
+		var fields map[string]interface{}
+		err := json.Unmarshal(doc, &fields)
+		names = append(names, fields["name"].(string))
+		return err
+	})
+	assert.NoError(t, err, "Error streaming documents")
+	assert.Len(t, names, 3)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = testDB.FindEach(query, func(doc json.RawMessage) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestBulkGet(t *testing.T) {
+	t.Log("Testing bulk get of revisions")
+	testData := map[string]string{"name": "test-bulk-get"}
+	id, rev, err := testDB.CreateDocument(testData)
+	assert.NoError(t, err)
+	newRev, err := testDB.UpdateDocument(id, rev, testData)
+	assert.NoError(t, err)
+
+	refs := []BulkGetRef{{id, rev}, {ID: id}, {ID: "missing-bulk-get"}}
+	results, err := testDB.BulkGet(refs, BulkGetOptions{Revs: true})
+	assert.NoError(t, err, "Error getting documents in bulk")
+	assert.Len(t, results, 3)
+
+	var doc struct {
+		Rev       string    `json:"_rev"`
+		Revisions Revisions `json:"_revisions"`
+	}
+	assert.NoError(t, json.Unmarshal(results[0].Doc, &doc))
+	assert.Equal(t, rev, doc.Rev)
+	assert.NoError(t, json.Unmarshal(results[1].Doc, &doc))
+	assert.Equal(t, newRev, doc.Rev)
+	assert.Len(t, doc.Revisions.IDs, 2)
+	assert.NotNil(t, results[2].Error)
+
+	results, err = testDB.BulkGet(refs[:1], BulkGetOptions{Latest: true})
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(results[0].Doc, &doc))
+	assert.Equal(t, newRev, doc.Rev)
+}
+
+func TestMembership(t *testing.T) {
+	t.Log("Testing getting cluster membership")
+	membership, err := testClient.Membership()
+	assert.NoError(t, err, "Error getting membership")
+	assert.NotEmpty(t, membership.AllNodes)
+	assert.NotEmpty(t, membership.ClusterNodes)
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Log("Testing getting node stats")
+	stats, err := testClient.NodeStats()
+	assert.NoError(t, err, "Error getting node stats")
+	assert.Contains(t, stats, "couchdb")
+}
+
+func TestWithJSON(t *testing.T) {
+	t.Log("Testing doc create and get with custom JSON functions")
+	marshalled, unmarshalled := 0, 0
+	client, err := NewClient(username, password, WithJSON(
+		func(v interface{}) ([]byte, error) {
+			marshalled++
+			return json.Marshal(v)
+		},
+		func(data []byte, v interface{}) error {
+			unmarshalled++
+			return json.Unmarshal(data, v)
+		},
+	))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	id, _, err := db.CreateDocument(map[string]string{"name": "test-json"})
+	assert.NoError(t, err)
+	resultData := make(map[string]string)
+	assert.NoError(t, db.GetDocument(id, &resultData, Options{}))
+	assert.Equal(t, "test-json", resultData["name"])
+	assert.Equal(t, 1, marshalled)
+	assert.Equal(t, 1, unmarshalled)
+
+	_, err = db.Patch(id, map[string]interface{}{"name": "test-json-patched"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, marshalled)
+	assert.Equal(t, 2, unmarshalled)
+
+	_, _, err = db.CreateDocumentWithAttachment(map[string]string{"name": "test-json-attachment"}, "a.txt", "text/plain", strings.NewReader("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, marshalled)
+}
+
+func TestBatchWriter(t *testing.T) {
+	t.Log("Testing batch writer")
+	w := testDB.NewBatchWriter(2, 50*time.Millisecond)
+	for _, name := range []string{"test-batch-1", "test-batch-2", "test-batch-3"} {
+		assert.NoError(t, w.Add(map[string]string{"name": name}))
+	}
+	query := Query{}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test-batch-"}}
+	count, err := testDB.Count(query)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count, "Full batch should be written")
+
+	time.Sleep(100 * time.Millisecond)
+	count, err = testDB.Count(query)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count, "Batch should be written after the interval")
+
+	assert.NoError(t, w.Add(map[string]string{"_id": "test-batch-dup", "name": "test-batch-4"}))
+	_, ok := w.Add(map[string]string{"_id": "test-batch-dup", "name": "test-batch-5"}).(*BulkError)
+	assert.True(t, ok, "Expected bulk error for conflicting document")
+	assert.NoError(t, w.Close())
+}
+
+func TestSearchInPartition(t *testing.T) {
+	t.Log("Testing search in a partition")
+	db := createPartitionedDB(t)
+	for _, id := range []string{"a:1", "a:2", "b:1"} {
+		_, err := db.UpdateDocument(id, "", map[string]string{"name": "test-partition-search"})
+		assert.NoError(t, err)
+	}
+	ddocJSON := `{
+		"options": {"partitioned": true},
+		"indexes": {"byName": {"index": "function(doc){ index(\"name\", doc.name); }"}}
+	}`
+	assert.NoError(t, db.CreateDesignDoc("search_test", ddocJSON))
+
+	ddoc := NewDesignDocument("search_test")
+	result, err := ddoc.SearchInPartition(db, "a", "byName", "name:test-partition-search", SearchOptions{})
+	assert.NoError(t, err, "Error searching in partition")
+	assert.Equal(t, 2, result.Num)
+
+	assert.NoError(t, testClient.DeleteDB(partitionedDBName))
+}
+
+func TestHasIndexFor(t *testing.T) {
+	t.Log("Testing index lookup for a query")
+	query := Query{Sort: []interface{}{"name"}}
+	query.Selector = map[string]interface{}{"id": "11", "name": map[string]interface{}{"$gt": ""}}
+	ok, name, err := testDB.HasIndexFor(query)
+	assert.NoError(t, err, "Error looking up index")
+	assert.True(t, ok)
+	assert.Equal(t, "by-id-name", name)
+
+	query.Selector = map[string]interface{}{"missing": "x"}
+	query.Sort = nil
+	ok, _, err = testDB.HasIndexFor(query)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	query.Selector = map[string]interface{}{"$text": "fox"}
+	ok, name, err = testDB.HasIndexFor(query)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "by-title-text", name)
+}
+
+func TestCreateDocumentWithID(t *testing.T) {
+	t.Log("Testing doc create with id after delete")
+	testData := map[string]string{"name": "test-recreate"}
+	rev, err := testDB.CreateDocumentWithID("test-recreate", testData, "")
+	assert.NoError(t, err, "Error creating document with id")
+	deletedRev, err := testDB.DeleteDocument("test-recreate", rev)
+	assert.NoError(t, err)
+
+	newRev, err := testDB.CreateDocumentWithID("test-recreate", testData, deletedRev)
+	assert.NoError(t, err, "Error recreating document on its tombstone")
+	gen, _, err := ParseRev(newRev)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, gen)
+
+	_, err = testDB.CreateDocumentWithID("test-recreate-missing", testData, deletedRev)
+	assert.True(t, IsConflict(err), "Expected conflict for rev of missing document")
+}
+
+func TestPaginate(t *testing.T) {
+	t.Log("Testing paginated search documents")
+	query := Query{}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test3-"}}
+	page := testDB.Paginate(query, 2)
+	docs, more, err := page.Next()
+	assert.NoError(t, err, "Error getting first page")
+	assert.Len(t, docs, 2)
+	assert.True(t, more)
+	assert.NotEmpty(t, page.Cursor())
+
+	query.Bookmark = page.Cursor()
+	resumed := testDB.Paginate(query, 2)
+	docs, more, err = resumed.Next()
+	assert.NoError(t, err, "Error getting page from cursor")
+	assert.Len(t, docs, 1)
+	assert.False(t, more)
+	docs, more, err = resumed.Next()
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+	assert.False(t, more)
+}
+
+func TestReplicationErrors(t *testing.T) {
+	t.Log("Testing replication error history")
+	replicator := testClient.DB("_replicator")
+	rev, err := replicator.CreateDocumentWithID("test-replication-errors", map[string]string{
+		"source": "https://missing-host.invalid/db",
+		"target": testDB.path,
+	}, "")
+	assert.NoError(t, err)
+
+	var errs []ReplicationError
+	for i := 0; i < 30 && len(errs) == 0; i++ {
+		time.Sleep(time.Second)
+		errs, err = testClient.ReplicationErrors("test-replication-errors")
+		if IsNotFound(err) {
+			continue
+		}
+		assert.NoError(t, err, "Error getting replication errors")
+	}
+	assert.NotEmpty(t, errs)
+	assert.NotEmpty(t, errs[0].Reason)
+	assert.False(t, errs[0].Time.IsZero())
+
+	_, err = replicator.DeleteDocument("test-replication-errors", rev)
+	assert.NoError(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	t.Log("Testing watching documents matching a selector")
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errc := testDB.Watch(ctx, map[string]interface{}{"name": "test-watch"})
+	time.Sleep(time.Second)
+	_, _, err := testDB.CreateDocument(map[string]string{"name": "test-watch-other"})
+	assert.NoError(t, err)
+	id, _, err := testDB.CreateDocument(map[string]string{"name": "test-watch"})
+	assert.NoError(t, err)
+
+	select {
+	case doc := <-docs:
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal(doc, &fields))
+		assert.Equal(t, id, fields["_id"])
+	case err := <-errc:
+		t.Fatal(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for watched document")
+	}
+
+	cancel()
+	_, ok := <-docs
+	assert.False(t, ok, "Expected channel to be closed on cancel")
+	assert.NoError(t, <-errc)
+}
+
+func TestTruncate(t *testing.T) {
+	t.Log("Testing DB truncate")
+	testClient.DeleteDB("test_db_truncate")
+	db, err := testClient.CreateDB("test_db_truncate")
+	assert.NoError(t, err)
+	for _, name := range []string{"a", "b", "c"} {
+		_, _, err := db.CreateDocument(map[string]string{"name": name})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.CreateDesignDoc("truncate_test", `{"views": {}}`))
+
+	deleted, err := db.Truncate(true)
+	assert.NoError(t, err, "Error truncating DB")
+	assert.Equal(t, 3, deleted)
+	_, err = db.GetDocumentRev("_design/truncate_test")
+	assert.NoError(t, err, "Design document should be kept")
+
+	deleted, err = db.Truncate(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	assert.NoError(t, testClient.DeleteDB("test_db_truncate"))
+}
+
+func TestDocumentCache(t *testing.T) {
+	t.Log("Testing doc get with cache")
+	client, err := NewClient(username, password, WithDocumentCache(10))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+	testData := map[string]string{"name": "test-cache"}
+	id, rev, err := db.CreateDocument(testData)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		resultData := make(map[string]string)
+		assert.NoError(t, db.GetDocument(id, &resultData, Options{}), "Error getting cached document")
+		assert.Equal(t, "test-cache", resultData["name"])
+	}
+	cachedRev, _, ok := client.cache.get(db.path + "/" + id)
+	assert.True(t, ok)
+	assert.Equal(t, rev, cachedRev)
+
+	testData["name"] = "test-cache-updated"
+	_, err = db.UpdateDocument(id, rev, testData)
+	assert.NoError(t, err)
+	resultData := make(map[string]string)
+	assert.NoError(t, db.GetDocument(id, &resultData, Options{}))
+	assert.Equal(t, "test-cache-updated", resultData["name"])
+
+	db.InvalidateCache(id)
+	_, _, ok = client.cache.get(db.path + "/" + id)
+	assert.False(t, ok)
+}
+
+func TestSearchDocumentLargeSelector(t *testing.T) {
+	t.Log("Testing search documents with a large selector")
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = "large-" + strconv.Itoa(i)
+	}
+	ids[500] = "11"
+	query := Query{Selector: map[string]interface{}{"id": map[string]interface{}{"$in": ids}}}
+
+	req := request.New().
+		SetBasicAuth(username, password).
+		Post(testDB.path + "/_find").
+		Send(query)
+	httpReq, err := req.MakeRequest()
+	assert.NoError(t, err)
+	assert.Equal(t, "POST", httpReq.Method)
+	assert.Empty(t, httpReq.URL.RawQuery)
+	assert.True(t, httpReq.ContentLength > 0, "Body should be buffered with a known length")
+
+	result, err := testDB.SearchDocument(query)
+	assert.NoError(t, err, "Error searching documents with large selector")
+	assert.Len(t, result, 1)
+}
+
+func TestCreateDBAndWait(t *testing.T) {
+	t.Log("Testing DB create and wait")
+	testClient.DeleteDB("test_db_wait")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	db, err := testClient.CreateDBAndWait(ctx, "test_db_wait")
+	assert.NoError(t, err, "Error creating DB and waiting")
+	_, _, err = db.CreateDocument(map[string]string{"name": "test-wait"})
+	assert.NoError(t, err)
+	assert.NoError(t, testClient.DeleteDB("test_db_wait"))
+}
+
+func TestInvalidBookmark(t *testing.T) {
+	t.Log("Testing search documents with an invalid bookmark")
+	query := Query{Bookmark: "not-a-bookmark"}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test3-"}}
+	_, err := testDB.SearchDocument(query)
+	assert.True(t, IsInvalidBookmark(err), "Expected invalid bookmark error")
+
+	err = testDB.FindEach(query, func(doc json.RawMessage) error { return nil })
+	assert.True(t, IsInvalidBookmark(err), "Expected invalid bookmark error")
+}
+
+func TestDesignDocumentSave(t *testing.T) {
+	t.Log("Testing idempotent design doc save")
+	ddoc := NewDesignDocument("save_test")
+	content := `{"views": {"by_name": {"map": "function(doc){ emit(doc.name, null); }"}}}`
+	assert.NoError(t, ddoc.Save(testDB, content), "Error saving design doc")
+	rev, err := testDB.GetDocumentRev(ddoc.ID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ddoc.Save(testDB, content))
+	unchangedRev, err := testDB.GetDocumentRev(ddoc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, rev, unchangedRev, "Unchanged design doc should not be written")
+
+	content = `{"views": {"by_id": {"map": "function(doc){ emit(doc.id, null); }"}}}`
+	assert.NoError(t, ddoc.Save(testDB, content))
+	newRev, err := testDB.GetDocumentRev(ddoc.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, rev, newRev)
+}
+
+func TestDesignDocumentDiff(t *testing.T) {
+	t.Log("Testing design doc drift detection")
+	ddoc := NewDesignDocument("save_test")
+	content := `{"_id": "_design/save_test", "views": {"by_id": {"map": "function(doc){ emit(doc.id, null); }"}}}`
+	differs, err := ddoc.Diff(testDB, content)
+	assert.NoError(t, err, "Error comparing design doc")
+	assert.False(t, differs)
+
+	content = `{"views": {"by_name": {"map": "function(doc){ emit(doc.name, null); }"}}}`
+	differs, err = ddoc.Diff(testDB, content)
+	assert.NoError(t, err)
+	assert.True(t, differs)
+
+	differs, err = NewDesignDocument("missing_ddoc").Diff(testDB, content)
+	assert.NoError(t, err)
+	assert.True(t, differs)
+}
+
+func TestWithCredentials(t *testing.T) {
+	t.Log("Testing client with other credentials")
+	client, err := testClient.WithCredentials(Credentials{username, password})
+	assert.NoError(t, err)
+	assert.Equal(t, testClient.transport, client.transport, "Transport should be shared")
+	assert.NoError(t, client.IsAlive())
+
+	other, err := testClient.WithCredentials(Credentials{username, "wrong-password"})
+	assert.NoError(t, err)
+	_, err = other.DB(testDBName).Info()
+	assert.Error(t, err, "Unexpected success with wrong password")
+}
+
+func TestStrictIndexes(t *testing.T) {
+	t.Log("Testing search documents with strict indexes")
+	client, err := NewClient(username, password, WithStrictIndexes())
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	query := Query{Selector: map[string]interface{}{"unindexed": "x"}}
+	_, err = db.SearchDocument(query)
+	assert.Equal(t, ErrFullScan, err, "Unindexed query should fail")
+	_, err = db.Count(query)
+	assert.Equal(t, ErrFullScan, err)
+
+	query.Selector = map[string]interface{}{"id": "11"}
+	result, err := db.SearchDocument(query)
+	assert.NoError(t, err, "Indexed query should succeed")
+	assert.Len(t, result, 1)
+}
+
+func TestPurgedInfosLimit(t *testing.T) {
+	t.Log("Testing purged infos limit")
+	err := testDB.SetPurgedInfosLimit(500)
+	assert.NoError(t, err, "Error setting purged infos limit")
+	limit, err := testDB.GetPurgedInfosLimit()
+	assert.NoError(t, err, "Error getting purged infos limit")
+	assert.Equal(t, 500, limit)
+}
+
+func TestDatabaseOperationResults(t *testing.T) {
+	t.Log("Testing DB create and delete results")
+	testClient.DeleteDB("test_db_results")
+	result, err := testClient.CreateDatabase("test_db_results")
+	assert.NoError(t, err, "Error creating DB")
+	assert.True(t, result.OK)
+	_, err = testClient.CreateDatabase("test_db_results")
+	assert.True(t, IsDBExists(err), "Expected exists error")
+
+	result, err = testClient.DeleteDatabase("test_db_results")
+	assert.NoError(t, err, "Error deleting DB")
+	assert.True(t, result.OK)
+	_, err = testClient.DeleteDatabase("test_db_results")
+	assert.True(t, IsNotFound(err), "Expected not found error")
+}
+
+func TestDBConcurrentUse(t *testing.T) {
+	t.Log("Testing concurrent use of a DB")
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "test-concurrent-" + strconv.Itoa(i)
+			id, rev, err := testDB.CreateDocument(map[string]string{"name": name})
+			if err == nil {
+				_, err = testDB.UpdateDocument(id, rev, map[string]string{"name": name + "-updated"})
+			}
+			if err == nil {
+				resultData := make(map[string]string)
+				err = testDB.GetDocument(id, &resultData, Options{})
+				if err == nil && resultData["name"] != name+"-updated" {
+					err = errors.New("Unexpected document " + resultData["name"] + " for " + name)
+				}
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t.Log("Testing dry run client")
+	client, err := NewClient(username, password, WithDryRun())
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	_, rev, err := db.CreateDocument(map[string]string{"_id": "test-dry-run", "name": "test-dry-run"})
+	assert.NoError(t, err, "Error creating document in dry run")
+	assert.NotEmpty(t, rev)
+	requests := client.DryRunRequests()
+	assert.Len(t, requests, 1)
+	assert.Contains(t, string(requests[0].Body), "test-dry-run")
+
+	resultData := make(map[string]string)
+	err = db.GetDocument("test-dry-run", &resultData, Options{})
+	assert.True(t, IsNotFound(err), "Document should not be written in dry run")
+}
+
+func TestAllDocsByKeys(t *testing.T) {
+	t.Log("Testing all docs by keys")
+	id, rev, err := testDB.CreateDocument(map[string]string{"name": "test-by-keys"})
+	assert.NoError(t, err)
+	rows, err := testDB.AllDocsByKeys([]string{id, "missing-by-keys"}, true)
+	assert.NoError(t, err, "Error getting all docs by keys")
+	assert.Len(t, rows, 2)
+	assert.Equal(t, id, rows[0].ID)
+	assert.Equal(t, rev, rows[0].Value.Rev)
+	assert.Contains(t, string(rows[0].Doc), "test-by-keys")
+	assert.Equal(t, "missing-by-keys", rows[1].Key)
+	assert.Equal(t, "not_found", rows[1].Error)
+}
+
+func TestExportViewCSV(t *testing.T) {
+	t.Log("Testing view CSV export")
+	ddoc := NewDesignDocument("save_test")
+	var buf bytes.Buffer
+	opts := ViewOptions{Key: "111", IncludeDocs: true}
+	err := ddoc.ExportViewCSV(testDB, "by_id", []string{"key", "name"}, &buf, opts)
+	assert.NoError(t, err, "Error exporting view as CSV")
+	assert.Equal(t, "key,name\n111,test3-3\n", buf.String())
+}
+
+func TestSecurity(t *testing.T) {
+	t.Log("Testing security document round trip")
+	authOnly := false
+	security := &Security{
+		Cloudant:        map[string][]string{"nobody": {"_reader"}},
+		CouchDBAuthOnly: &authOnly,
+	}
+	assert.NoError(t, testDB.SetSecurity(security), "Error setting security")
+	result, err := testDB.GetSecurity()
+	assert.NoError(t, err, "Error getting security")
+	assert.Equal(t, []string{"_reader"}, result.Cloudant["nobody"])
+
+	assert.NoError(t, testDB.SetSecurity(&Security{}))
+}
+
+func TestEnsureDocuments(t *testing.T) {
+	t.Log("Testing ensuring documents exist")
+	rev, err := testDB.CreateDocumentWithID("test-ensure-1", map[string]string{"name": "existing"}, "")
+	assert.NoError(t, err)
+	docs := []IdentifiedDoc{
+		{"test-ensure-1", map[string]string{"name": "seed-1"}},
+		{"test-ensure-2", map[string]string{"name": "seed-2"}},
+	}
+	results, err := testDB.EnsureDocuments(docs)
+	assert.NoError(t, err, "Error ensuring documents")
+	assert.Len(t, results, 1)
+	assert.Equal(t, "test-ensure-2", results[0].ID)
+
+	currentRev, err := testDB.GetDocumentRev("test-ensure-1")
+	assert.NoError(t, err)
+	assert.Equal(t, rev, currentRev, "Existing document should be untouched")
+
+	results, err = testDB.EnsureDocuments(docs)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestFindAll(t *testing.T) {
+	t.Log("Testing finding all documents")
+	query := Query{Limit: 2}
+	query.Selector = map[string]interface{}{"name": map[string]interface{}{"$regex": "^test3-"}}
+	docs, err := testDB.FindAll(query)
+	assert.NoError(t, err, "Error finding all documents")
+	assert.Len(t, docs, 3)
+
+	client, err := NewClient(username, password, WithFindAllLimit(2))
+	assert.NoError(t, err)
+	_, err = client.DB(testDBName).FindAll(query)
+	assert.Equal(t, ErrTooManyResults, err)
+}
+
+func TestGetDocumentResp(t *testing.T) {
+	t.Log("Testing doc get with response")
+	id, rev, err := testDB.CreateDocument(map[string]string{"name": "test-resp"})
+	assert.NoError(t, err)
+	resultData := make(map[string]string)
+	resp, err := testDB.GetDocumentResp(id, &resultData, Options{})
+	assert.NoError(t, err, "Error getting document with response")
+	defer resp.Body.Close()
+	assert.Equal(t, "test-resp", resultData["name"])
+	assert.Equal(t, `"`+rev+`"`, resp.Header.Get("ETag"))
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "test-resp")
+}
+
+func TestBulkCreateAllOrNothing(t *testing.T) {
+	t.Log("Testing bulk create with all or nothing")
+	docs := []interface{}{
+		map[string]string{"name": "test-all-or-nothing-1"},
+		map[string]string{"name": "test-all-or-nothing-2"},
+	}
+	results, _, err := testDB.BulkCreate(docs, BulkOptions{AllOrNothing: true})
+	assert.NoError(t, err, "Error creating documents with all or nothing")
+	assert.Len(t, results, 2)
+	for _, result := range results {
+		assert.NotEmpty(t, result.Rev)
+	}
+}
+
+func TestConsumeChanges(t *testing.T) {
+	t.Log("Testing changes consumption with checkpoints")
+	consumer := "test-consumer-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	seen := 0
+	err := testDB.ConsumeChanges(context.Background(), consumer, 10, func(rows []ChangeRow) error {
+		seen += len(rows)
+		return nil
+	})
+	assert.NoError(t, err, "Error consuming changes")
+	assert.NotZero(t, seen)
+
+	_, _, err = testDB.CreateDocument(map[string]string{"name": "test-consume"})
+	assert.NoError(t, err)
+	var rows []ChangeRow
+	err = testDB.ConsumeChanges(context.Background(), consumer, 10, func(batch []ChangeRow) error {
+		rows = append(rows, batch...)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+}
+
+func TestListAttachments(t *testing.T) {
+	t.Log("Testing attachment listing")
+	doc := map[string]interface{}{"name": "test-list-attachments"}
+	AttachInline(doc, "b.txt", "text/plain", []byte("hello"))
+	AttachInline(doc, "a.json", "application/json", []byte("{}"))
+	id, _, err := testDB.CreateDocument(doc)
+	assert.NoError(t, err)
+	infos, err := testDB.ListAttachments(id)
+	assert.NoError(t, err, "Error listing attachments")
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, "a.json", infos[0].Name)
+		assert.Equal(t, "application/json", infos[0].ContentType)
+		assert.Equal(t, "b.txt", infos[1].Name)
+		assert.Equal(t, int64(5), infos[1].Length)
+		assert.NotEmpty(t, infos[1].Digest)
+	}
+}
+
+func TestDatabaseNotFound(t *testing.T) {
+	t.Log("Testing database not found errors")
+	_, err := testClient.DB("missing_db").Info()
+	assert.True(t, IsDatabaseNotFound(err), "Expected database not found error")
+	assert.True(t, IsNotFound(err))
+
+	var doc map[string]interface{}
+	err = testDB.GetDocument("missing-doc", &doc, Options{})
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsDatabaseNotFound(err), "Missing document reported as missing database")
+}
+
+func TestGetRevs(t *testing.T) {
+	t.Log("Testing rev lookups")
+	id, rev, err := testDB.CreateDocument(map[string]string{"name": "test-get-revs"})
+	assert.NoError(t, err)
+	deletedID, deletedRev, err := testDB.CreateDocument(map[string]string{"name": "test-get-revs-deleted"})
+	assert.NoError(t, err)
+	_, err = testDB.DeleteDocument(deletedID, deletedRev)
+	assert.NoError(t, err)
+	revs, err := testDB.GetRevs([]string{id, deletedID, "missing-doc"})
+	assert.NoError(t, err, "Error getting revs")
+	assert.Equal(t, map[string]string{id: rev}, revs)
+}
+
+func TestIDField(t *testing.T) {
+	t.Log("Testing id field promotion")
+	type item struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	client, err := NewClient(username, password, WithIDField("id"))
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+	id := "test-id-field-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	created, _, err := db.CreateDocument(item{ID: id, Name: "test-id-field"})
+	assert.NoError(t, err, "Error creating document with id field")
+	assert.Equal(t, id, created)
+
+	var read item
+	assert.NoError(t, db.GetDocument(id, &read, Options{}))
+	assert.Equal(t, item{ID: id, Name: "test-id-field"}, read)
+
+	created, _, err = db.CreateDocument(map[string]string{"name": "test-id-field"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created)
+}
+
+func TestDesignDocInfo(t *testing.T) {
+	t.Log("Testing design doc info")
+	ddoc := NewDesignDocument("example")
+	assert.NoError(t, ddoc.BuildIndex(testDB, "foo"))
+	info, err := ddoc.Info(testDB)
+	assert.NoError(t, err, "Error getting design doc info")
+	assert.Equal(t, "example", info.Name)
+	assert.NotEmpty(t, info.ViewIndex.Signature)
+	assert.NotEmpty(t, info.ViewIndex.UpdateSeq)
+}
+
+func TestNextSequence(t *testing.T) {
+	t.Log("Testing sequence counter")
+	counterID := "test-counter-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[int64]bool)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := testDB.NextSequence(counterID)
+			assert.NoError(t, err, "Error incrementing counter")
+			mu.Lock()
+			seen[n] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[int64]bool{1: true, 2: true, 3: true, 4: true, 5: true}, seen)
+}
+
+func TestPartialIndex(t *testing.T) {
+	t.Log("Testing partial index")
+	index := Index{Name: "by-name-partial", Ddoc: "partial-index", Type: "json"}
+	index.Index.Fields = []string{"name"}
+	index.Index.PartialFilterSelector = map[string]interface{}{"kind": "partial"}
+	assert.NoError(t, testDB.SetIndex(index), "Error setting partial index")
+
+	query := Query{UseIndex: []string{"partial-index", "by-name-partial"}}
+	query.Selector = map[string]interface{}{"kind": "partial", "name": map[string]interface{}{"$gt": ""}}
+	var plan struct {
+		Index struct {
+			Name string `json:"name"`
+		} `json:"index"`
+	}
+	req := request.New().
+		SetBasicAuth(testDB.username, testDB.password).
+		Post(testDB.path + "/_explain").
+		Send(query)
+	assert.NoError(t, testClient.end(req, &plan))
+	assert.Equal(t, "by-name-partial", plan.Index.Name)
+
+	query.UseIndex = nil
+	ok, name, err := testDB.HasIndexFor(query)
+	assert.NoError(t, err)
+	assert.False(t, ok && name == "by-name-partial", "Partial index reported as usable")
+}
+
+func TestBulkCreateMixedResults(t *testing.T) {
+	t.Log("Testing bulk create with fresh and conflicting documents")
+	id, _, err := testDB.CreateDocument(map[string]string{"name": "test-bulk-mixed"})
+	assert.NoError(t, err)
+	docs := []interface{}{
+		map[string]string{"name": "test-bulk-mixed-fresh"},
+		map[string]string{"_id": id, "name": "test-bulk-mixed-conflict"},
+	}
+	results, _, err := testDB.BulkCreate(docs, BulkOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.True(t, results[0].OK)
+		assert.NotEmpty(t, results[0].Rev)
+		assert.False(t, results[1].OK)
+		assert.True(t, results[1].IsConflict())
+		assert.Equal(t, id, results[1].ID)
+	}
+}
+
+func TestImport(t *testing.T) {
+	t.Log("Testing import with progress")
+	input := `{"name": "test-import-1"}
+[{"name": "test-import-2"}, {"name": "test-import-3"}]
+{"_id": "test-import-conflict", "_rev": "1-0000", "name": "test-import-4"}
+`
+	var calls [][2]int
+	done, failed, err := testDB.Import(context.Background(), strings.NewReader(input), 2, func(done, failed int) {
+		calls = append(calls, [2]int{done, failed})
+	})
+	assert.NoError(t, err, "Error importing documents")
+	assert.Equal(t, 3, done)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, [][2]int{{2, 0}, {3, 1}}, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, failed, err = testDB.Import(ctx, strings.NewReader(input), 1, func(done, failed int) {
+		cancel()
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, done)
+	assert.Equal(t, 0, failed)
+}
+
+func TestThroughputUsage(t *testing.T) {
+	t.Log("Testing throughput usage")
+	throughput, err := testClient.ThroughputUsage()
+	assert.NoError(t, err, "Error getting throughput usage")
+	assert.NotZero(t, throughput.Limits.Read)
+	assert.NotZero(t, throughput.Limits.Write)
+	assert.NotZero(t, throughput.Limits.Query)
+}
+
+func TestRename(t *testing.T) {
+	t.Log("Testing doc rename")
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	oldID, newID := "test-rename-old-"+suffix, "test-rename-new-"+suffix
+	_, err := testDB.CreateDocumentWithID(oldID, map[string]string{"name": "test-rename"}, "")
+	assert.NoError(t, err)
+	rev, err := testDB.Rename(oldID, newID, false)
+	assert.NoError(t, err, "Error renaming document")
+	resultData := make(map[string]string)
+	assert.NoError(t, testDB.GetDocument(newID, &resultData, Options{}))
+	assert.Equal(t, "test-rename", resultData["name"])
+	assert.Equal(t, rev, resultData["_rev"])
+	err = testDB.GetDocument(oldID, &resultData, Options{})
+	assert.True(t, IsNotFound(err), "Old document should be deleted")
+
+	_, err = testDB.CreateDocumentWithID(oldID, map[string]string{"name": "test-rename-2"}, "")
+	assert.NoError(t, err)
+	_, err = testDB.Rename(oldID, newID, false)
+	assert.True(t, IsConflict(err), "Expected conflict renaming to an existing id")
+	_, err = testDB.Rename(oldID, newID, true)
+	assert.NoError(t, err, "Error renaming over an existing document")
+	assert.NoError(t, testDB.GetDocument(newID, &resultData, Options{}))
+	assert.Equal(t, "test-rename-2", resultData["name"])
+}
+
+func TestStrictIndexesSort(t *testing.T) {
+	t.Log("Testing sort validation with strict indexes")
+	client, err := NewClient(username, password, WithStrictIndexes())
+	assert.NoError(t, err)
+	db := client.DB(testDBName)
+
+	query := Query{Sort: []interface{}{"unindexed"}}
+	query.Selector = map[string]interface{}{"id": "11"}
+	_, err = db.SearchDocument(query)
+	sortErr, ok := err.(*UnsortableError)
+	if assert.True(t, ok, "Expected unsortable error") {
+		assert.Equal(t, []string{"unindexed"}, sortErr.Fields)
+	}
+	_, err = db.FindAll(query)
+	assert.IsType(t, &UnsortableError{}, err)
+}
+
+func TestProjectedFields(t *testing.T) {
+	t.Log("Testing field projection in all docs and bulk get")
+	id, _, err := testDB.CreateDocument(map[string]string{"name": "test-projection", "extra": "x"})
+	assert.NoError(t, err)
+	rows, err := testDB.AllDocsMultiQuery([]AllDocsQuery{{Keys: []string{id}, IncludeDocs: true, Fields: []string{"name"}}})
+	assert.NoError(t, err, "Error querying all docs with fields")
+	if assert.Len(t, rows, 1) && assert.Len(t, rows[0], 1) {
+		assert.JSONEq(t, `{"name":"test-projection"}`, string(rows[0][0].Doc))
+	}
+
+	results, err := testDB.BulkGet([]BulkGetRef{{ID: id}}, BulkGetOptions{Fields: []string{"_id", "extra"}})
+	assert.NoError(t, err, "Error getting documents with fields")
+	if assert.Len(t, results, 1) {
+		assert.JSONEq(t, `{"_id":"`+id+`","extra":"x"}`, string(results[0].Doc))
+	}
+}
+
+func TestWaitForDocument(t *testing.T) {
+	t.Log("Testing waiting for a document")
+	id := "test-wait-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		testDB.CreateDocumentWithID(id, map[string]string{"name": "test-wait"}, "")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rev, err := testDB.WaitForDocument(ctx, id)
+	assert.NoError(t, err, "Error waiting for document")
+	assert.NotEmpty(t, rev)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = testDB.WaitForDocument(ctx, "missing-doc")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestAllLocalDocs(t *testing.T) {
+	t.Log("Testing listing local docs")
+	consumer := "test-local-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := testDB.ConsumeChanges(context.Background(), consumer, 10, func([]ChangeRow) error { return nil })
+	assert.NoError(t, err)
+	ids, err := testDB.AllLocalDocs()
+	assert.NoError(t, err, "Error listing local docs")
+	assert.Contains(t, ids, "_local/"+consumer)
+
+	rows, err := testDB.LocalDocs(Options{"include_docs": true, "key": "_local/" + consumer})
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.Contains(t, string(rows[0].Doc), "last_seq")
+	}
+}
+
+func TestRenameDryRun(t *testing.T) {
+	t.Log("Testing doc rename in dry run")
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	oldID, newID := "test-rename-dry-old-"+suffix, "test-rename-dry-new-"+suffix
+	_, err := testDB.CreateDocumentWithID(oldID, map[string]string{"name": "test-rename-dry"}, "")
+	assert.NoError(t, err)
+
+	client, err := NewClient(username, password, WithDryRun())
+	assert.NoError(t, err)
+	_, err = client.DB(testDBName).Rename(oldID, newID, false)
+	assert.NoError(t, err, "Error renaming document in dry run")
+	requests := client.DryRunRequests()
+	if assert.Len(t, requests, 2) {
+		assert.Equal(t, "COPY", requests[0].Method)
+		assert.Equal(t, "DELETE", requests[1].Method)
+	}
+
+	resultData := make(map[string]string)
+	assert.NoError(t, testDB.GetDocument(oldID, &resultData, Options{}), "Old document should be kept in dry run")
+	err = testDB.GetDocument(newID, &resultData, Options{})
+	assert.True(t, IsNotFound(err), "Document should not be copied in dry run")
+}
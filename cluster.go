@@ -0,0 +1,72 @@
+package cloudant
+
+import (
+	"sort"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ShardMap describes how a database is split in shards across the nodes of
+// the cluster.
+type ShardMap struct {
+	// ByRange maps each shard range to the nodes holding a copy of it.
+	ByRange map[string][]string
+	// ByNode maps each node to the shard ranges it holds.
+	ByNode map[string][]string
+}
+
+// Shards returns the shard map of the database.
+func (db *DB) Shards() (ShardMap, error) {
+	var data struct {
+		Shards map[string][]string `json:"shards"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/_shards")
+	if err := db.client.end(req, &data); err != nil {
+		return ShardMap{}, err
+	}
+	shards := ShardMap{ByRange: data.Shards, ByNode: make(map[string][]string)}
+	for shardRange, nodes := range data.Shards {
+		for _, node := range nodes {
+			shards.ByNode[node] = append(shards.ByNode[node], shardRange)
+		}
+	}
+	for _, ranges := range shards.ByNode {
+		sort.Strings(ranges)
+	}
+	return shards, nil
+}
+
+// Membership lists the nodes of the cluster.
+type Membership struct {
+	// AllNodes are the nodes this node knows about.
+	AllNodes []string `json:"all_nodes"`
+	// ClusterNodes are the nodes configured as members of the cluster.
+	ClusterNodes []string `json:"cluster_nodes"`
+}
+
+// Membership returns the nodes of the cluster.
+func (c *Client) Membership() (Membership, error) {
+	var data Membership
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Get(c.Client.URL() + "/_membership")
+	if err := c.end(req, &data); err != nil {
+		return Membership{}, err
+	}
+	return data, nil
+}
+
+// NodeStats returns the statistics of the node serving the request, such
+// as request rates and latencies, as parsed from the JSON response.
+func (c *Client) NodeStats() (map[string]interface{}, error) {
+	var data map[string]interface{}
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Get(c.Client.URL() + "/_node/_local/_stats")
+	if err := c.end(req, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
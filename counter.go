@@ -0,0 +1,38 @@
+package cloudant
+
+import (
+	"math/rand"
+	"time"
+)
+
+// counterRetries is the number of times NextSequence retries an increment
+// on conflict.
+const counterRetries = 20
+
+// NextSequence increments the counter stored in the document counterID,
+// creating it if needed, and returns its new value, starting at 1. Each
+// increment is a write of the current revision, retried on conflict after
+// a random delay, so that concurrent callers never get the same value.
+// Under heavy contention the conflict may still be returned once retries
+// are exhausted.
+func (db *DB) NextSequence(counterID string) (int64, error) {
+	var err error
+	for i := 0; i <= counterRetries; i++ {
+		var counter struct {
+			Rev   string `json:"_rev,omitempty"`
+			Value int64  `json:"value"`
+		}
+		if err = db.Get(counterID, &counter, nil); err != nil && !IsNotFound(err) {
+			return 0, err
+		}
+		counter.Value++
+		if _, err = db.Put(counterID, map[string]interface{}{"value": counter.Value}, counter.Rev); err == nil {
+			return counter.Value, nil
+		}
+		if !IsConflict(err) {
+			return 0, err
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(retryBaseDelay))))
+	}
+	return 0, err
+}
@@ -0,0 +1,121 @@
+package cloudant
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// Save writes the design document from its JSON content, creating it or
+// updating the current revision. Nothing is written if the stored design
+// document already has the same content, so that saving is idempotent and
+// doesn't trigger index rebuilds.
+func (ddoc *DesignDocument) Save(db *DB, content string) error {
+	fields, err := designContent([]byte(content))
+	if err != nil {
+		return err
+	}
+	stored, rev, err := ddoc.stored(db)
+	if err != nil {
+		return err
+	}
+	if stored != nil && reflect.DeepEqual(fields, stored) {
+		return nil
+	}
+	fields["_id"] = ddoc.ID
+	if rev != "" {
+		fields["_rev"] = rev
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = db.PutRaw(ddoc.ID, data)
+	return err
+}
+
+// Diff tells whether the design document stored in db differs from the
+// given JSON content, ignoring _id, _rev and the order of keys. A design
+// document that doesn't exist differs from any content.
+func (ddoc *DesignDocument) Diff(db *DB, content string) (bool, error) {
+	fields, err := designContent([]byte(content))
+	if err != nil {
+		return false, err
+	}
+	stored, _, err := ddoc.stored(db)
+	if err != nil {
+		return false, err
+	}
+	return stored == nil || !reflect.DeepEqual(fields, stored), nil
+}
+
+// DesignDocInfo describes the view index of a design document.
+type DesignDocInfo struct {
+	Name      string `json:"name"`
+	ViewIndex struct {
+		Signature string `json:"signature"`
+		Language  string `json:"language"`
+		// UpdateSeq is the sequence of the database the index is up to
+		// date with.
+		UpdateSeq Seq `json:"update_seq"`
+		PurgeSeq  Seq `json:"purge_seq"`
+		// UpdaterRunning tells whether the index is being updated.
+		UpdaterRunning bool `json:"updater_running"`
+		CompactRunning bool `json:"compact_running"`
+		WaitingClients int  `json:"waiting_clients"`
+		Sizes          struct {
+			File     int64 `json:"file"`
+			External int64 `json:"external"`
+			Active   int64 `json:"active"`
+		} `json:"sizes"`
+	} `json:"view_index"`
+}
+
+// Info returns information about the view index of the design document,
+// such as how far it is from the update sequence of the database.
+func (ddoc *DesignDocument) Info(db *DB) (*DesignDocInfo, error) {
+	info := &DesignDocInfo{}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/" + ddoc.ID + "/_info")
+	if err := db.client.end(req, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// stored returns the content and revision of the design document as stored
+// in db, or nil content if it doesn't exist.
+func (ddoc *DesignDocument) stored(db *DB) (map[string]interface{}, string, error) {
+	var raw json.RawMessage
+	if err := db.Get(ddoc.ID, &raw, nil); err != nil {
+		if IsNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	var meta struct {
+		Rev string `json:"_rev"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, "", err
+	}
+	fields, err := designContent(raw)
+	return fields, meta.Rev, err
+}
+
+// designContent decodes the JSON content of a design document, leaving out
+// its _id and _rev.
+func designContent(data []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	delete(fields, "_rev")
+	return fields, nil
+}
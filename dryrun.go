@@ -0,0 +1,153 @@
+package cloudant
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DryRunRequest is a write request recorded instead of being sent, in dry
+// run mode.
+type DryRunRequest struct {
+	Method string
+	URL    string
+	Body   []byte
+}
+
+// dryRunTransport records write requests and answers them with synthetic
+// successful responses, without sending them. Reads are sent as usual.
+type dryRunTransport struct {
+	rt http.RoundTripper
+
+	mu       sync.Mutex
+	requests []DryRunRequest
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isWrite(req) {
+		return t.rt.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, DryRunRequest{req.Method, req.URL.String(), body})
+	t.mu.Unlock()
+
+	var reply interface{}
+	header := http.Header{"Content-Type": {"application/json"}}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && req.Method != "POST":
+		// Database creation or deletion.
+		reply = map[string]bool{"ok": true}
+	case segments[len(segments)-1] == "_bulk_docs":
+		var data struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		json.Unmarshal(body, &data)
+		results := make([]BulkResult, len(data.Docs))
+		for i, doc := range data.Docs {
+			id, _ := doc["_id"].(string)
+			rev, _ := doc["_rev"].(string)
+			results[i] = dryRunResult(id, rev)
+		}
+		reply = results
+	default:
+		id := strings.Join(segments[1:], "/")
+		rev := req.URL.Query().Get("rev")
+		var doc struct {
+			ID  string `json:"_id"`
+			Rev string `json:"_rev"`
+		}
+		json.Unmarshal(body, &doc)
+		switch req.Method {
+		case "POST":
+			id = doc.ID
+		case "COPY":
+			// The copy is written at the destination, at its revision.
+			dest, err := url.Parse(req.Header.Get("Destination"))
+			if err != nil {
+				return nil, err
+			}
+			id, rev = dest.Path, dest.Query().Get("rev")
+		}
+		if rev == "" {
+			rev = doc.Rev
+		}
+		result := dryRunResult(id, rev)
+		header.Set("ETag", `"`+result.Rev+`"`)
+		reply = map[string]interface{}{"ok": true, "id": result.ID, "rev": result.Rev}
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "201 Created",
+		StatusCode:    http.StatusCreated,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// dryRunResult returns a synthetic successful write of the document id at
+// revision rev, giving it an id if it has none.
+func dryRunResult(id, rev string) BulkResult {
+	if id == "" {
+		id, _ = newUUID()
+	}
+	gen, _, err := ParseRev(rev)
+	if err != nil {
+		gen = 0
+	}
+	hash, _ := newUUID()
+	return BulkResult{ID: id, Rev: strconv.Itoa(gen+1) + "-" + hash}
+}
+
+// dryRunWrites are the endpoints of POST requests that write to the
+// database. Other POST requests, such as _find, are reads.
+var dryRunWrites = map[string]bool{
+	"_bulk_docs": true,
+	"_index":     true,
+	"_purge":     true,
+	"_compact":   true,
+}
+
+// isWrite tells whether req writes to the server.
+func isWrite(req *http.Request) bool {
+	switch req.Method {
+	case "PUT", "DELETE", "COPY":
+		return true
+	case "POST":
+		segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		return len(segments) == 1 || dryRunWrites[segments[len(segments)-1]]
+	}
+	return false
+}
+
+// DryRunRequests returns the write requests recorded in dry run mode.
+func (c *Client) DryRunRequests() []DryRunRequest {
+	if c.dryRun == nil {
+		return nil
+	}
+	c.dryRun.mu.Lock()
+	defer c.dryRun.mu.Unlock()
+	return append([]DryRunRequest(nil), c.dryRun.requests...)
+}
@@ -0,0 +1,89 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTransport(t *testing.T) {
+	t.Log("Testing dry run transport")
+	rt := &dryRunTransport{rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "GET" && !strings.HasSuffix(req.URL.Path, "/_find") {
+			return nil, errors.New("write request sent")
+		}
+		return okResponse(req)
+	})}
+
+	req, _ := http.NewRequest("PUT", "https://example.com/db/doc?rev=2-abc", strings.NewReader(`{"name":"a"}`))
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	var result BulkResult
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, "doc", result.ID)
+	assert.True(t, strings.HasPrefix(result.Rev, "3-"))
+	assert.Equal(t, `"`+result.Rev+`"`, resp.Header.Get("ETag"))
+
+	req, _ = http.NewRequest("POST", "https://example.com/db/_bulk_docs", strings.NewReader(`{"docs":[{"_id":"a"},{}]}`))
+	resp, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	var results []BulkResult
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, json.Unmarshal(body, &results))
+	assert.Len(t, results, 2)
+	assert.Equal(t, "a", results[0].ID)
+	assert.NotEmpty(t, results[1].ID)
+
+	req, _ = http.NewRequest("COPY", "https://example.com/db/old?rev=1-abc", nil)
+	req.Header.Set("Destination", "new?rev=4-def")
+	resp, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, "new", result.ID)
+	assert.True(t, strings.HasPrefix(result.Rev, "5-"))
+
+	req, _ = http.NewRequest("POST", "https://example.com/db/_find", strings.NewReader(`{}`))
+	_, err = rt.RoundTrip(req)
+	assert.NoError(t, err, "Reads should be sent")
+
+	assert.Len(t, rt.requests, 3)
+	assert.Equal(t, `{"name":"a"}`, string(rt.requests[0].Body))
+}
+
+func TestRenameEscape(t *testing.T) {
+	t.Log("Testing doc ids are escaped in the COPY request of Rename")
+	var copyReq *http.Request
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "COPY" {
+			copyReq = req
+		}
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"ok":true,"rev":"1-a"}`)),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt).DB("db")
+
+	_, err := db.Rename("a/b", "_design/c d", false)
+	assert.NoError(t, err)
+	if assert.NotNil(t, copyReq) {
+		assert.Equal(t, "/db/a%2Fb", copyReq.URL.EscapedPath())
+		assert.Equal(t, "_design/c%20d", copyReq.Header.Get("Destination"))
+
+		// The dry run reads the id back from the escaped destination.
+		resp, err := (&dryRunTransport{}).RoundTrip(copyReq)
+		assert.NoError(t, err)
+		var result BulkResult
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, json.Unmarshal(body, &result))
+		assert.Equal(t, "_design/c d", result.ID)
+	}
+}
@@ -0,0 +1,198 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+	couchdb "github.com/timjacobi/go-couchdb"
+)
+
+// responseError returns a *couchdb.Error describing a failed response, so
+// that errors from raw requests can be inspected in the same way as errors
+// returned by the underlying couchdb client. It returns nil on success.
+func responseError(resp request.Response, body []byte) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+	var reply struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(body, &reply)
+	couchErr := &couchdb.Error{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		ErrorCode:  reply.Error,
+		Reason:     reply.Reason,
+	}
+	if isDatabaseNotFound(couchErr) {
+		return &DatabaseNotFoundError{couchErr}
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		wait, _ := retryAfter(resp)
+		return &ServiceUnavailableError{couchErr, wait}
+	}
+	return couchErr
+}
+
+// IsNotFound reports whether err is a not_found error, including for a
+// missing database.
+func IsNotFound(err error) bool {
+	if _, ok := err.(*DatabaseNotFoundError); ok {
+		return true
+	}
+	return couchdb.NotFound(err)
+}
+
+// DatabaseNotFoundError is returned by requests on a database that doesn't
+// exist, as opposed to a missing document, which is reported as a not_found
+// *couchdb.Error. It satisfies IsNotFound as well.
+type DatabaseNotFoundError struct {
+	Err *couchdb.Error
+}
+
+func (e *DatabaseNotFoundError) Error() string {
+	return e.Err.Error()
+}
+
+// IsDatabaseNotFound reports whether err is returned because the database
+// doesn't exist.
+func IsDatabaseNotFound(err error) bool {
+	switch err := err.(type) {
+	case *DatabaseNotFoundError:
+		return true
+	case *couchdb.Error:
+		return isDatabaseNotFound(err)
+	}
+	return false
+}
+
+// isDatabaseNotFound tells whether err is the not_found error returned for a
+// missing database.
+func isDatabaseNotFound(err *couchdb.Error) bool {
+	return err.StatusCode == http.StatusNotFound && strings.HasPrefix(err.Reason, "Database does not exist")
+}
+
+// IsDBExists reports whether err is returned for creating a database that
+// already exists.
+func IsDBExists(err error) bool {
+	couchErr, ok := err.(*couchdb.Error)
+	return ok && couchErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// ServiceUnavailableError is returned when the server responds with 503,
+// such as during maintenance. RetryAfter is the delay given by the server
+// before trying again, or zero if none was given.
+type ServiceUnavailableError struct {
+	Err        *couchdb.Error
+	RetryAfter time.Duration
+}
+
+func (e *ServiceUnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+// IsUnavailable reports whether err is returned because the service is
+// unavailable.
+func IsUnavailable(err error) bool {
+	switch err := err.(type) {
+	case *ServiceUnavailableError:
+		return true
+	case *couchdb.Error:
+		return err.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// IsConflict reports whether err is a conflict error.
+func IsConflict(err error) bool {
+	if _, ok := err.(*ConflictError); ok {
+		return true
+	}
+	return couchdb.Conflict(err)
+}
+
+// ConflictError is returned by UpdateDocument when the given revision is not
+// the current one. Rev holds the current revision of the document, so that
+// the update can be retried without fetching it first.
+type ConflictError struct {
+	Err *couchdb.Error
+	Rev string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Err.Error()
+}
+
+// InvalidBookmarkError is returned when paging through the results of a
+// query or a search with a bookmark that the server no longer accepts, for
+// instance after the index was rebuilt. Paging must restart without a
+// bookmark.
+type InvalidBookmarkError struct {
+	Err      *couchdb.Error
+	Bookmark string
+}
+
+func (e *InvalidBookmarkError) Error() string {
+	return e.Err.Error()
+}
+
+// IsInvalidBookmark reports whether err is an invalid bookmark error.
+func IsInvalidBookmark(err error) bool {
+	_, ok := err.(*InvalidBookmarkError)
+	return ok
+}
+
+// bookmarkError turns the error of a request sent with a bookmark into an
+// *InvalidBookmarkError if the server rejected the bookmark.
+func bookmarkError(err error, bookmark string) error {
+	couchErr, ok := err.(*couchdb.Error)
+	if !ok || bookmark == "" || couchErr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+	if couchErr.ErrorCode == "invalid_bookmark" || strings.Contains(strings.ToLower(couchErr.Reason), "bookmark") {
+		return &InvalidBookmarkError{couchErr, bookmark}
+	}
+	return err
+}
+
+// DocError describes the failure of a single document in a bulk request.
+type DocError struct {
+	ID     string
+	Error  string
+	Reason string
+}
+
+// BulkError is returned when one or more documents of a bulk request failed.
+type BulkError struct {
+	Docs []DocError
+}
+
+func (e *BulkError) Error() string {
+	ids := make([]string, len(e.Docs))
+	for i, doc := range e.Docs {
+		ids[i] = doc.ID + ": " + doc.Error
+	}
+	return fmt.Sprintf("Error in %d documents: %s", len(e.Docs), strings.Join(ids, ", "))
+}
+
+// AttachmentsError is returned when one or more attachments of a batch
+// could not be downloaded.
+type AttachmentsError struct {
+	Errors map[AttachmentRef]error
+}
+
+func (e *AttachmentsError) Error() string {
+	refs := make([]string, 0, len(e.Errors))
+	for ref, err := range e.Errors {
+		refs = append(refs, ref.DocID+"/"+ref.Name+": "+err.Error())
+	}
+	sort.Strings(refs)
+	return fmt.Sprintf("Error in %d attachments: %s", len(e.Errors), strings.Join(refs, ", "))
+}
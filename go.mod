@@ -0,0 +1,13 @@
+module github.com/IBM-Bluemix/go-cloudant
+
+go 1.13
+
+require (
+	github.com/davecgh/go-spew v1.0.1-0.20160907170601-6d212800a42e // indirect
+	github.com/moul/http2curl v0.0.0-20160520213128-b1479103caac // indirect
+	github.com/parnurzeal/gorequest v0.2.15
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v0.0.0-20151028094244-d8ed2627bdf0 // indirect
+	github.com/stretchr/testify v1.1.4
+	golang.org/x/net v0.0.0-20161003235214-ffe101cce347 // indirect
+)
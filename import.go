@@ -0,0 +1,79 @@
+package cloudant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Import writes the documents read from r into the database, in
+// _bulk_docs requests of up to batchSize documents. r holds a stream of
+// JSON values, each being a document or an array of documents, such as
+// newline delimited JSON. Documents are written as is: those holding a
+// _rev update that revision, and fail with a conflict if it isn't the
+// current one.
+//
+// progress, if not nil, is called after each batch with the number of
+// documents written and failed so far, which are returned as well. Once
+// ctx is done, Import stops after the current batch and returns the
+// counts along with the error of ctx.
+func (db *DB) Import(ctx context.Context, r io.Reader, batchSize int, progress func(done, failed int)) (done, failed int, err error) {
+	if batchSize <= 0 {
+		batchSize = queryPageSize
+	}
+	d := json.NewDecoder(r)
+	var batch []interface{}
+	write := func() error {
+		results, err := db.bulkDocs(batch)
+		if err != nil {
+			return err
+		}
+		batch = nil
+		for _, result := range results {
+			if result.Error != "" {
+				failed++
+			} else {
+				done++
+			}
+		}
+		if progress != nil {
+			progress(done, failed)
+		}
+		return nil
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return done, failed, err
+		}
+		var value json.RawMessage
+		if err := d.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return done, failed, err
+		}
+		docs := []json.RawMessage{value}
+		if bytes.HasPrefix(value, []byte("[")) {
+			if err := json.Unmarshal(value, &docs); err != nil {
+				return done, failed, err
+			}
+		}
+		for _, doc := range docs {
+			batch = append(batch, doc)
+			if len(batch) == batchSize {
+				if err := write(); err != nil {
+					return done, failed, err
+				}
+				if err := ctx.Err(); err != nil {
+					return done, failed, err
+				}
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := write(); err != nil {
+			return done, failed, err
+		}
+	}
+	return done, failed, nil
+}
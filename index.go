@@ -0,0 +1,270 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// IndexInfo describes an index of a database.
+type IndexInfo struct {
+	Ddoc string `json:"ddoc"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Def  struct {
+		Fields                []map[string]string    `json:"fields"`
+		PartialFilterSelector map[string]interface{} `json:"partial_filter_selector,omitempty"`
+	} `json:"def"`
+}
+
+// IndexResult reports whether EnsureIndexes created an index.
+type IndexResult struct {
+	Name    string
+	Created bool
+}
+
+// ListIndexes returns the indexes of the database.
+func (db *DB) ListIndexes() ([]IndexInfo, error) {
+	var data struct {
+		Indexes []IndexInfo `json:"indexes"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/_index")
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	return data.Indexes, nil
+}
+
+// EnsureIndexes creates those of indexes that don't exist yet, and reports
+// for each one whether it was created. An index exists if one of the same
+// type, with the same set of fields and partial filter selector, and the
+// same name if one is given, is already defined.
+func (db *DB) EnsureIndexes(indexes []Index) ([]IndexResult, error) {
+	existing, err := db.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]IndexResult, len(indexes))
+	for i, index := range indexes {
+		results[i].Name = index.Name
+		if info := findIndex(existing, index); info != nil {
+			results[i].Name = info.Name
+			continue
+		}
+		if err := db.SetIndex(index); err != nil {
+			return results, err
+		}
+		results[i].Created = true
+	}
+	return results, nil
+}
+
+// HasIndexFor tells whether the database has an index the query can use,
+// and returns its name. It checks the index definitions without running
+// the query: a JSON index is usable if the selector constrains all of its
+// fields, and it covers every sort field. A text index is usable by
+// selectors using $text. Partial indexes are left out, since they are only
+// used when named by the query. The most specific usable index is
+// returned.
+func (db *DB) HasIndexFor(query Query) (bool, string, error) {
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return false, "", err
+	}
+	selected := make(map[string]bool)
+	text := selectorFields(query.Selector, "", selected)
+	sortFields := indexFields(query.Sort)
+	var best *IndexInfo
+	for i, info := range indexes {
+		if info.Type == "text" {
+			if text && best == nil {
+				best = &indexes[i]
+			}
+			continue
+		}
+		if text || len(info.Def.Fields) == 0 || info.Def.PartialFilterSelector != nil {
+			continue
+		}
+		fields := make(map[string]bool)
+		usable := true
+		for _, field := range info.Def.Fields {
+			for k := range field {
+				fields[k] = true
+				usable = usable && selected[k]
+			}
+		}
+		for _, k := range sortFields {
+			usable = usable && fields[k]
+		}
+		if usable && (best == nil || len(info.Def.Fields) > len(best.Def.Fields)) {
+			best = &indexes[i]
+		}
+	}
+	if best == nil {
+		return false, "", nil
+	}
+	return true, best.Name, nil
+}
+
+// selectorFields adds the dot separated paths of the fields constrained by
+// selector to fields, and tells whether it uses the $text operator.
+func selectorFields(selector map[string]interface{}, prefix string, fields map[string]bool) (text bool) {
+	for k, v := range selector {
+		switch {
+		case k == "$text":
+			text = true
+		case k == "$and":
+			list, _ := v.([]interface{})
+			for _, sub := range list {
+				if m, ok := sub.(map[string]interface{}); ok {
+					text = selectorFields(m, prefix, fields) || text
+				}
+			}
+		case strings.HasPrefix(k, "$"):
+			// Other combination operators don't constrain every document
+			// to have the fields they mention.
+		default:
+			fields[prefix+k] = true
+			if m, ok := v.(map[string]interface{}); ok {
+				text = selectorFields(m, prefix+k+".", fields) || text
+			}
+		}
+	}
+	return text
+}
+
+// sortFields returns the names of the fields of a sort, in order, given
+// either as field names or as {"field": "asc"} objects.
+func sortFields(sort []interface{}) []string {
+	fields := make([]string, 0, len(sort))
+	for _, field := range sort {
+		switch f := field.(type) {
+		case string:
+			fields = append(fields, f)
+		case map[string]string:
+			for k := range f {
+				fields = append(fields, k)
+			}
+		case map[string]interface{}:
+			for k := range f {
+				fields = append(fields, k)
+			}
+		}
+	}
+	return fields
+}
+
+// canSort tells whether one of the JSON indexes has fields starting with
+// the given sort fields, in order.
+func canSort(indexes []IndexInfo, fields []string) bool {
+	for _, info := range indexes {
+		if info.Type == "text" || len(info.Def.Fields) < len(fields) {
+			continue
+		}
+		prefix := true
+		for i, field := range fields {
+			if _, ok := info.Def.Fields[i][field]; !ok {
+				prefix = false
+				break
+			}
+		}
+		if prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// findIndex returns the existing index matching the definition of index:
+// with the same type, set of fields and partial filter selector, and the
+// same name unless it is empty.
+func findIndex(indexes []IndexInfo, index Index) *IndexInfo {
+	indexType := index.Type
+	if indexType == "" {
+		indexType = "json"
+	}
+	fields := indexFields(index.Index.Fields)
+	if indexType == "text" {
+		fields = textIndexFields(index.Index.Fields)
+	}
+	filter := normalizeJSON(index.Index.PartialFilterSelector)
+	for i, info := range indexes {
+		if index.Name != "" && index.Name != info.Name {
+			continue
+		}
+		if info.Type != indexType || !reflect.DeepEqual(filter, normalizeJSON(info.Def.PartialFilterSelector)) {
+			continue
+		}
+		// Listed indexes give their fields as {"field": "asc"} objects, or
+		// {"field": "type"} objects for text indexes.
+		var infoFields []string
+		for _, field := range info.Def.Fields {
+			for k := range field {
+				infoFields = append(infoFields, k)
+			}
+		}
+		sort.Strings(infoFields)
+		if reflect.DeepEqual(fields, infoFields) {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+// indexFields returns the sorted names of the fields of an index
+// definition, given either as field names or as {"field": "asc"} objects.
+func indexFields(def interface{}) []string {
+	var list []interface{}
+	if data, err := json.Marshal(def); err == nil {
+		json.Unmarshal(data, &list)
+	}
+	var fields []string
+	for _, field := range list {
+		switch f := field.(type) {
+		case string:
+			fields = append(fields, f)
+		case map[string]interface{}:
+			for k := range f {
+				fields = append(fields, k)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// textIndexFields returns the sorted names of the fields of a text index
+// definition, given as {"name": "field", "type": "string"} objects.
+func textIndexFields(def interface{}) []string {
+	var list []struct {
+		Name string `json:"name"`
+	}
+	if data, err := json.Marshal(def); err == nil {
+		json.Unmarshal(data, &list)
+	}
+	var fields []string
+	for _, field := range list {
+		fields = append(fields, field.Name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// normalizeJSON returns v as decoded from its JSON encoding, so that values
+// built in Go compare equal to the same values decoded from a response.
+// Empty maps and nil are both returned as nil.
+func normalizeJSON(v map[string]interface{}) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	var normalized interface{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &normalized)
+	}
+	return normalized
+}
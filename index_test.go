@@ -0,0 +1,110 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectorFields(t *testing.T) {
+	t.Log("Testing fields constrained by a selector")
+	selector := map[string]interface{}{
+		"name":  "test",
+		"owner": map[string]interface{}{"email": map[string]interface{}{"$gt": ""}},
+		"$and": []interface{}{
+			map[string]interface{}{"count": map[string]interface{}{"$gt": 1}},
+		},
+		"$or": []interface{}{
+			map[string]interface{}{"tag": "a"},
+		},
+	}
+	fields := make(map[string]bool)
+	assert.False(t, selectorFields(selector, "", fields))
+	assert.Equal(t, map[string]bool{
+		"name":        true,
+		"owner":       true,
+		"owner.email": true,
+		"count":       true,
+	}, fields)
+
+	assert.True(t, selectorFields(map[string]interface{}{"$text": "fox"}, "", fields))
+}
+
+func TestCanSort(t *testing.T) {
+	t.Log("Testing sort validation against indexes")
+	indexes := []IndexInfo{
+		{Name: "by-name-age", Type: "json"},
+		{Name: "by-text", Type: "text"},
+	}
+	indexes[0].Def.Fields = []map[string]string{{"name": "asc"}, {"age": "asc"}}
+	indexes[1].Def.Fields = []map[string]string{{"title": "string"}}
+
+	sort := []interface{}{"name", map[string]interface{}{"age": "desc"}}
+	assert.Equal(t, []string{"name", "age"}, sortFields(sort))
+	assert.True(t, canSort(indexes, []string{"name"}))
+	assert.True(t, canSort(indexes, []string{"name", "age"}))
+	assert.False(t, canSort(indexes, []string{"age"}), "Sort fields must be a prefix")
+	assert.False(t, canSort(indexes, []string{"title"}), "Text indexes are not used")
+}
+
+func TestFindIndex(t *testing.T) {
+	t.Log("Testing matching index definitions against existing indexes")
+	var existing []IndexInfo
+	err := json.Unmarshal([]byte(`[
+		{"ddoc": "_design/a", "name": "by-name", "type": "json", "def": {"fields": [{"name": "asc"}]}},
+		{"ddoc": "_design/b", "name": "by-name-text", "type": "text", "def": {"fields": [{"name": "string"}]}},
+		{"ddoc": "_design/c", "name": "active-by-name", "type": "json", "def": {"fields": [{"name": "asc"}], "partial_filter_selector": {"active": true}}}
+	]`), &existing)
+	assert.NoError(t, err)
+
+	index := Index{}
+	index.Index.Fields = []string{"name"}
+	assert.Equal(t, "by-name", findIndex(existing, index).Name)
+
+	index = Index{Type: "text"}
+	index.Index.Fields = []map[string]string{{"name": "name", "type": "string"}}
+	assert.Equal(t, "by-name-text", findIndex(existing, index).Name)
+
+	index = Index{}
+	index.Index.Fields = []string{"name"}
+	index.Index.PartialFilterSelector = map[string]interface{}{"active": true}
+	assert.Equal(t, "active-by-name", findIndex(existing, index).Name)
+
+	index.Index.PartialFilterSelector = map[string]interface{}{"active": false}
+	assert.Nil(t, findIndex(existing, index), "Partial filters should be compared")
+
+	index = Index{Type: "text"}
+	index.Index.Fields = []map[string]string{{"name": "title", "type": "string"}}
+	assert.Nil(t, findIndex(existing, index))
+}
+
+func TestEnsureTextIndex(t *testing.T) {
+	t.Log("Testing ensuring a text index twice")
+	var indexes []string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "POST" {
+			indexes = append(indexes, `{"ddoc":"_design/t","name":"by-title","type":"text","def":{"fields":[{"title":"string"}]}}`)
+		}
+		body := `{"indexes":[` + strings.Join(indexes, ",") + `]}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt).DB("db")
+	index := Index{Name: "by-title", Type: "text"}
+	index.Index.Fields = []map[string]string{{"name": "title", "type": "string"}}
+
+	results, err := db.EnsureIndexes([]Index{index})
+	assert.NoError(t, err)
+	assert.Equal(t, []IndexResult{{Name: "by-title", Created: true}}, results)
+	results, err = db.EnsureIndexes([]Index{index})
+	assert.NoError(t, err)
+	assert.Equal(t, []IndexResult{{Name: "by-title", Created: false}}, results)
+	assert.Len(t, indexes, 1)
+}
@@ -0,0 +1,53 @@
+package cloudant
+
+import (
+	"strconv"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// GetRevsLimit returns the maximum number of revisions tracked per document.
+func (db *DB) GetRevsLimit() (int, error) {
+	var limit int
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/_revs_limit")
+	if err := db.client.end(req, &limit); err != nil {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// SetRevsLimit sets the maximum number of revisions tracked per document.
+// Lowering it reduces the metadata kept for frequently updated documents.
+func (db *DB) SetRevsLimit(n int) error {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Put(db.path + "/_revs_limit").
+		SendString(strconv.Itoa(n))
+	return db.client.end(req, nil)
+}
+
+// GetPurgedInfosLimit returns the maximum number of purge requests whose
+// history is kept, for replicas to catch up on purges.
+func (db *DB) GetPurgedInfosLimit() (int, error) {
+	var limit int
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/_purged_infos_limit")
+	if err := db.client.end(req, &limit); err != nil {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// SetPurgedInfosLimit sets the maximum number of purge requests whose
+// history is kept. Replicas lagging further behind than this number of
+// purges don't receive them.
+func (db *DB) SetPurgedInfosLimit(n int) error {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Put(db.path + "/_purged_infos_limit").
+		SendString(strconv.Itoa(n))
+	return db.client.end(req, nil)
+}
@@ -0,0 +1,130 @@
+package cloudant
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// MergeDocuments performs a three-way merge of documents a and b, which
+// were both derived from base. Fields changed on only one side are taken
+// from that side, and nested objects are merged recursively. Fields changed
+// differently on both sides are reported in conflicts, as dot separated
+// paths, and keep the value from a in merged.
+func MergeDocuments(base, a, b map[string]interface{}) (merged map[string]interface{}, conflicts []string) {
+	merged, conflicts = mergeMaps("", base, a, b)
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+func mergeMaps(prefix string, base, a, b map[string]interface{}) (map[string]interface{}, []string) {
+	merged := make(map[string]interface{})
+	var conflicts []string
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{base, a, b} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		baseVal, inBase := base[k]
+		aVal, inA := a[k]
+		bVal, inB := b[k]
+		aChanged := inA != inBase || !reflect.DeepEqual(aVal, baseVal)
+		bChanged := inB != inBase || !reflect.DeepEqual(bVal, baseVal)
+		switch {
+		case !bChanged:
+			if inA {
+				merged[k] = aVal
+			}
+		case !aChanged:
+			if inB {
+				merged[k] = bVal
+			}
+		case inA == inB && reflect.DeepEqual(aVal, bVal):
+			if inA {
+				merged[k] = aVal
+			}
+		default:
+			aMap, aIsMap := aVal.(map[string]interface{})
+			bMap, bIsMap := bVal.(map[string]interface{})
+			if aIsMap && bIsMap {
+				baseMap, _ := baseVal.(map[string]interface{})
+				sub, subConflicts := mergeMaps(prefix+k+".", baseMap, aMap, bMap)
+				merged[k] = sub
+				conflicts = append(conflicts, subConflicts...)
+				continue
+			}
+			conflicts = append(conflicts, prefix+k)
+			if inA {
+				merged[k] = aVal
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+// patchRetries is the number of times Patch retries an update on conflict.
+const patchRetries = 5
+
+// Patch applies a partial update to a document, and returns its new
+// revision. The patch is merged into the current document: nested objects
+// are merged recursively, other values replace those of the document, and
+// nil values remove fields. The update is retried if the document was
+// changed concurrently.
+func (db *DB) Patch(id string, patch map[string]interface{}) (string, error) {
+	var err error
+	for i := 0; i <= patchRetries; i++ {
+		var raw json.RawMessage
+		if err = db.Get(id, &raw, nil); err != nil {
+			return "", err
+		}
+		// Decode numbers as json.Number so that they are written back as is,
+		// unless documents are decoded with WithJSON.
+		doc := make(map[string]interface{})
+		if db.client.jsonUnmarshal != nil {
+			err = db.unmarshal(raw, &doc)
+		} else {
+			d := json.NewDecoder(bytes.NewReader(raw))
+			d.UseNumber()
+			err = d.Decode(&doc)
+		}
+		if err != nil {
+			return "", err
+		}
+		rev, _ := doc["_rev"].(string)
+		var body interface{}
+		if body, err = db.marshal(mergePatch(doc, patch)); err != nil {
+			return "", err
+		}
+		var newRev string
+		newRev, err = db.Put(id, body, rev)
+		if err == nil {
+			return newRev, nil
+		}
+		if !IsConflict(err) {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// mergePatch merges patch into doc, following JSON merge patch semantics.
+func mergePatch(doc, patch map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(doc, k)
+		case map[string]interface{}:
+			sub, _ := doc[k].(map[string]interface{})
+			doc[k] = mergePatch(sub, v)
+		default:
+			doc[k] = v
+		}
+	}
+	return doc
+}
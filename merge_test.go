@@ -0,0 +1,59 @@
+package cloudant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeDocuments(t *testing.T) {
+	t.Log("Testing three-way document merge")
+	base := map[string]interface{}{
+		"name":  "test",
+		"count": 1,
+		"tags":  "a",
+		"owner": map[string]interface{}{"name": "x", "email": "x@example.com"},
+	}
+	a := map[string]interface{}{
+		"name":  "test-a",
+		"count": 2,
+		"owner": map[string]interface{}{"name": "y", "email": "x@example.com"},
+	}
+	b := map[string]interface{}{
+		"name":  "test",
+		"count": 3,
+		"tags":  "a",
+		"extra": true,
+		"owner": map[string]interface{}{"name": "x", "email": "z@example.com"},
+	}
+	merged, conflicts := MergeDocuments(base, a, b)
+	assert.Equal(t, map[string]interface{}{
+		"name":  "test-a",
+		"count": 2,
+		"extra": true,
+		"owner": map[string]interface{}{"name": "y", "email": "z@example.com"},
+	}, merged)
+	assert.Equal(t, []string{"count"}, conflicts)
+}
+
+func TestMergePatch(t *testing.T) {
+	t.Log("Testing JSON merge patch")
+	doc := map[string]interface{}{
+		"name":  "test",
+		"tags":  []interface{}{"a"},
+		"old":   true,
+		"owner": map[string]interface{}{"name": "x", "email": "x@example.com"},
+	}
+	patch := map[string]interface{}{
+		"tags":  []interface{}{"b"},
+		"old":   nil,
+		"owner": map[string]interface{}{"email": "y@example.com"},
+		"extra": map[string]interface{}{"count": 1},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"name":  "test",
+		"tags":  []interface{}{"b"},
+		"owner": map[string]interface{}{"name": "x", "email": "y@example.com"},
+		"extra": map[string]interface{}{"count": 1},
+	}, mergePatch(doc, patch))
+}
@@ -0,0 +1,239 @@
+package cloudant
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientOption configures a Client created by NewClient.
+type ClientOption func(*Client)
+
+// WithUseNumber makes GetDocument, SearchDocument and FindOne decode JSON
+// numbers into interface{} values as json.Number instead of float64, so
+// that large integers such as 64-bit ids keep their precision.
+func WithUseNumber() ClientOption {
+	return func(c *Client) {
+		c.useNumber = true
+	}
+}
+
+// WithMaxConcurrency bounds the number of requests the client has in flight
+// at once to n. Requests beyond the limit wait until an earlier request
+// completes, rather than failing. A request is in flight until its response
+// body has been read. Continuous and long polling changes feeds, as read by
+// ContinuousChanges and Watch, are not limited, since they stay open.
+func WithMaxConcurrency(n int) ClientOption {
+	return func(c *Client) {
+		c.maxConcurrency = n
+	}
+}
+
+// WithDefaultHeader sets a header sent with every request of the client,
+// unless the request sets it already.
+func WithDefaultHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Add(key, value)
+	}
+}
+
+// WithDefaultQueryParam sets a query parameter sent with every request of
+// the client, unless the request sets it already.
+func WithDefaultQueryParam(key, value string) ClientOption {
+	return func(c *Client) {
+		if c.query == nil {
+			c.query = make(url.Values)
+		}
+		c.query.Add(key, value)
+	}
+}
+
+// IDStrategy returns the id of a new document, given its fields. An empty
+// id lets the server assign one.
+type IDStrategy func(fields map[string]interface{}) (string, error)
+
+// UUIDStrategy generates random ids on the client.
+func UUIDStrategy(fields map[string]interface{}) (string, error) {
+	return newUUID()
+}
+
+// FieldStrategy uses the value of field as the id, such as a natural key.
+// Documents without the field are rejected.
+func FieldStrategy(field string) IDStrategy {
+	return func(fields map[string]interface{}) (string, error) {
+		value, ok := fields[field]
+		if !ok || value == nil {
+			return "", errors.New("Missing id field: " + field)
+		}
+		return fmt.Sprint(value), nil
+	}
+}
+
+// WithIDStrategy sets how CreateDocument assigns ids to documents. A
+// document that has an _id keeps it, whatever the strategy. By default, the
+// server assigns ids.
+func WithIDStrategy(strategy IDStrategy) ClientOption {
+	return func(c *Client) {
+		c.idStrategy = strategy
+	}
+}
+
+// WithIDField makes CreateDocument use the value of field as the _id of
+// documents that don't have one, such as a struct field tagged
+// `json:"id"`. The field is kept in the document, so that it is filled
+// when the document is read back. Documents without the field get an id
+// from the IDStrategy, or from the server.
+func WithIDField(field string) ClientOption {
+	return func(c *Client) {
+		c.idField = field
+	}
+}
+
+// WithCircuitBreaker makes the client fail requests immediately with
+// ErrCircuitOpen after threshold consecutive failures, for the duration of
+// cooldown. A single request is then let through to probe the server,
+// closing the circuit if it succeeds. Network errors and 5xx responses
+// count as failures, but not requests canceled or timed out by their
+// context.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		c.breakerThreshold = threshold
+		c.breakerCooldown = cooldown
+	}
+}
+
+// HedgeConfig configures the hedging of GET requests.
+type HedgeConfig struct {
+	// Delay is how long to wait for a response before sending a second
+	// copy of the request.
+	Delay time.Duration
+}
+
+// WithHedging makes the client send a second copy of GET requests whose
+// response headers were not received within cfg.Delay, and use the first
+// response. This trims the tail latency of reads at the cost of more load
+// on the server. Other requests are never hedged. A hedged request and its
+// copy count as a single request for the circuit breaker.
+func WithHedging(cfg HedgeConfig) ClientOption {
+	return func(c *Client) {
+		c.hedgeDelay = cfg.Delay
+	}
+}
+
+// WithRetries makes the client retry idempotent requests failing with a
+// network error, a 429 or a 5xx response, up to n times. WithRetryPredicate
+// changes which requests are retried. Retries back off
+// exponentially, or wait for the Retry-After delay given by the server.
+// Retried requests go through the circuit breaker, if any.
+func WithRetries(n int) ClientOption {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// WithRetryPredicate sets which failed requests are retried, instead of
+// DefaultRetryPredicate. The predicate should only allow retrying
+// requests that are safe to send again, which POST requests writing
+// documents are not.
+func WithRetryPredicate(retryIf RetryPredicate) ClientOption {
+	return func(c *Client) {
+		c.retryIf = retryIf
+	}
+}
+
+// WithRetryBudget caps the total number of retries made by the client, so
+// that retries don't pile up during an outage. Up to size retries can be
+// made at once, and the budget refills at perSecond retries per second.
+// Once it is exhausted, failures are returned without retrying.
+func WithRetryBudget(size int, perSecond float64) ClientOption {
+	return func(c *Client) {
+		c.retryBudget = newRetryBudget(size, perSecond)
+	}
+}
+
+// WithJSON makes the client encode and decode documents with the given
+// functions instead of encoding/json, for instance to use a faster library
+// or to support special types. WithUseNumber has no effect on documents
+// decoded by unmarshal. Other request and response bodies are still
+// handled by encoding/json.
+func WithJSON(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) ClientOption {
+	return func(c *Client) {
+		c.jsonMarshal = marshal
+		c.jsonUnmarshal = unmarshal
+	}
+}
+
+// WithStrictIndexes makes the client check each Mango query with _explain
+// before running it, and fail it with ErrFullScan if no index can serve it.
+// Sorted queries are also checked against the indexes, and failed with an
+// *UnsortableError if none can sort them. This costs extra requests per
+// query, and is meant to enforce that all queries of an application are
+// indexed.
+func WithStrictIndexes() ClientOption {
+	return func(c *Client) {
+		c.strictIndexes = true
+	}
+}
+
+// WithDryRun makes the client record write requests instead of sending
+// them, answering them with synthetic ids and revisions. Reads are still
+// sent to the server. The recorded requests are returned by
+// Client.DryRunRequests.
+func WithDryRun() ClientOption {
+	return func(c *Client) {
+		c.dryRun = &dryRunTransport{}
+	}
+}
+
+// WithFindAllLimit sets the maximum number of documents returned by
+// FindAll.
+func WithFindAllLimit(n int) ClientOption {
+	return func(c *Client) {
+		c.findAllLimit = n
+	}
+}
+
+// WithDocumentCache enables a cache of up to size documents, kept in
+// memory and evicted least recently used first. GetDocument still makes a
+// request for each document, but a cached document is only transferred
+// again if its revision changed. DB.InvalidateCache removes a document
+// from the cache.
+func WithDocumentCache(size int) ClientOption {
+	return func(c *Client) {
+		c.cache = newDocCache(size)
+	}
+}
+
+// marshal returns doc encoded with the marshal function of WithJSON, as a
+// json.RawMessage. Without it, doc is returned as is.
+func (db *DB) marshal(doc interface{}) (interface{}, error) {
+	if db.client.jsonMarshal == nil {
+		return doc, nil
+	}
+	data, err := db.client.jsonMarshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// unmarshal decodes a JSON document into v, honoring WithJSON and
+// WithUseNumber.
+func (db *DB) unmarshal(data []byte, v interface{}) error {
+	if db.client.jsonUnmarshal != nil {
+		return db.client.jsonUnmarshal(data, v)
+	}
+	if !db.client.useNumber {
+		return json.Unmarshal(data, v)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
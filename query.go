@@ -0,0 +1,326 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+	couchdb "github.com/timjacobi/go-couchdb"
+)
+
+// queryPageSize is the number of documents fetched per request when paging
+// through the results of a query.
+const queryPageSize = 200
+
+// ErrFullScan is returned with WithStrictIndexes for queries that no index
+// can serve.
+var ErrFullScan = errors.New("query would scan all documents: no usable index")
+
+// checkIndexed returns ErrFullScan if query would be served by scanning
+// all documents, as reported by _explain.
+func (db *DB) checkIndexed(query Query) error {
+	var plan struct {
+		Index struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"index"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_explain").
+		Send(query)
+	if err := db.client.end(req, &plan); err != nil {
+		return err
+	}
+	if plan.Index.Type == "special" {
+		return ErrFullScan
+	}
+	return nil
+}
+
+// UnsortableError is returned with WithStrictIndexes for queries sorting on
+// fields that no JSON index can sort by. An index can sort by fields it
+// starts with, in the same order.
+type UnsortableError struct {
+	Fields []string
+}
+
+func (e *UnsortableError) Error() string {
+	return "no index can sort by " + strings.Join(e.Fields, ", ") +
+		": create a JSON index whose fields start with the sort fields, in order"
+}
+
+// checkSort returns an *UnsortableError if no index can sort the results
+// of query.
+func (db *DB) checkSort(query Query) error {
+	if len(query.Sort) == 0 {
+		return nil
+	}
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return err
+	}
+	if fields := sortFields(query.Sort); !canSort(indexes, fields) {
+		return &UnsortableError{fields}
+	}
+	return nil
+}
+
+// checkQuery runs the checks of WithStrictIndexes on query. It is called
+// once per query, rather than for each page of results.
+func (db *DB) checkQuery(query Query) error {
+	if !db.client.strictIndexes {
+		return nil
+	}
+	if err := db.checkSort(query); err != nil {
+		return err
+	}
+	return db.checkIndexed(query)
+}
+
+// find runs a Mango query, decodes the matching documents into docs and
+// returns the bookmark of the next page of results. A rejected bookmark is
+// returned as an *InvalidBookmarkError.
+func (db *DB) find(query Query, docs interface{}) (string, error) {
+	data := struct {
+		Docs     interface{} `json:"docs"`
+		Bookmark string      `json:"bookmark"`
+	}{Docs: docs}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_find").
+		Send(query)
+	if err := db.client.end(req, &data); err != nil {
+		return "", bookmarkError(err, query.Bookmark)
+	}
+	return data.Bookmark, nil
+}
+
+// DeleteByQuery deletes the documents matching the selector of query, up
+// to the limit of query if set, and returns the number of documents
+// deleted. Matching documents are fetched and deleted in pages. Documents
+// that could not be deleted are reported in a *BulkError.
+func (db *DB) DeleteByQuery(query Query) (deleted int, err error) {
+	if err := db.checkQuery(query); err != nil {
+		return 0, err
+	}
+	limit := query.Limit
+	query.Fields = []string{"_id", "_rev"}
+	query.Limit = queryPageSize
+	bulkErr := &BulkError{}
+	for seen := 0; limit <= 0 || seen < limit; {
+		if limit > 0 && limit-seen < query.Limit {
+			query.Limit = limit - seen
+		}
+		var docs []struct {
+			ID  string `json:"_id"`
+			Rev string `json:"_rev"`
+		}
+		if query.Bookmark, err = db.find(query, &docs); err != nil {
+			return deleted, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		seen += len(docs)
+		tombstones := make([]interface{}, len(docs))
+		for i, doc := range docs {
+			tombstones[i] = map[string]interface{}{
+				"_id":      doc.ID,
+				"_rev":     doc.Rev,
+				"_deleted": true,
+			}
+		}
+		results, err := db.bulkDocs(tombstones)
+		if err != nil {
+			return deleted, err
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				bulkErr.Docs = append(bulkErr.Docs, DocError{result.ID, result.Error, result.Reason})
+				continue
+			}
+			deleted++
+		}
+		if len(docs) < query.Limit {
+			break
+		}
+	}
+	if len(bulkErr.Docs) > 0 {
+		return deleted, bulkErr
+	}
+	return deleted, nil
+}
+
+// FindOne decodes the first document matching query into out. The sort
+// order of query is respected, and a not_found error is returned if no
+// document matches.
+func (db *DB) FindOne(query Query, out interface{}) error {
+	if err := db.checkQuery(query); err != nil {
+		return err
+	}
+	query.Limit = 1
+	var docs []json.RawMessage
+	if _, err := db.find(query, &docs); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return &couchdb.Error{
+			Method:     "POST",
+			URL:        db.path + "/_find",
+			StatusCode: http.StatusNotFound,
+			ErrorCode:  "not_found",
+			Reason:     "no matching document",
+		}
+	}
+	return db.unmarshal(docs[0], out)
+}
+
+// Count returns the number of documents matching the selector of query.
+// Mango has no native count, so this pages through every match fetching
+// only its _id: the cost grows with the number of matches. For large
+// result sets, prefer a view with a _count reduce function.
+func (db *DB) Count(query Query) (int, error) {
+	if err := db.checkQuery(query); err != nil {
+		return 0, err
+	}
+	query.Fields = []string{"_id"}
+	query.Limit = queryPageSize
+	count := 0
+	for {
+		var docs []json.RawMessage
+		bookmark, err := db.find(query, &docs)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+		if len(docs) < query.Limit {
+			return count, nil
+		}
+		query.Bookmark = bookmark
+	}
+}
+
+// FindEach calls fn for each document matching query, fetching the results
+// in pages so that memory use stays bounded. The limit of query sets the
+// page size. Iteration stops at the first error returned by fn.
+func (db *DB) FindEach(query Query, fn func(doc json.RawMessage) error) error {
+	if err := db.checkQuery(query); err != nil {
+		return err
+	}
+	if query.Limit == 0 {
+		query.Limit = queryPageSize
+	}
+	for {
+		var docs []json.RawMessage
+		bookmark, err := db.find(query, &docs)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		if len(docs) < query.Limit {
+			return nil
+		}
+		query.Bookmark = bookmark
+	}
+}
+
+// DefaultFindAllLimit is the maximum number of documents returned by
+// FindAll, unless set with WithFindAllLimit.
+const DefaultFindAllLimit = 10000
+
+// ErrTooManyResults is returned by FindAll when more documents match than
+// allowed.
+var ErrTooManyResults = errors.New("too many matching documents")
+
+// FindAll returns all the documents matching query, fetching them page by
+// page. To avoid loading an unbounded number of documents in memory, it
+// fails with ErrTooManyResults past DefaultFindAllLimit documents, or the
+// limit set with WithFindAllLimit. Use FindEach to process any number of
+// documents.
+func (db *DB) FindAll(query Query) ([]json.RawMessage, error) {
+	limit := db.client.findAllLimit
+	if limit <= 0 {
+		limit = DefaultFindAllLimit
+	}
+	var docs []json.RawMessage
+	err := db.FindEach(query, func(doc json.RawMessage) error {
+		if len(docs) == limit {
+			return ErrTooManyResults
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Page iterates over the results of a query one page at a time.
+type Page struct {
+	db      *DB
+	query   Query
+	done    bool
+	checked bool
+}
+
+// Paginate returns a Page iterating over the documents matching query in
+// pages of pageSize documents, or of 200 documents if pageSize isn't
+// positive. Paging starts from the bookmark of query, if set, so that a
+// cursor returned by Page.Cursor can be resumed.
+func (db *DB) Paginate(query Query, pageSize int) *Page {
+	if pageSize <= 0 {
+		pageSize = queryPageSize
+	}
+	query.Limit = pageSize
+	return &Page{db: db, query: query}
+}
+
+// Next returns the next page of documents, and tells whether more pages
+// may follow. The last page may be empty when the number of documents is a
+// multiple of the page size.
+func (p *Page) Next() ([]json.RawMessage, bool, error) {
+	if p.done {
+		return nil, false, nil
+	}
+	if !p.checked {
+		if err := p.db.checkQuery(p.query); err != nil {
+			return nil, false, err
+		}
+		p.checked = true
+	}
+	var docs []json.RawMessage
+	bookmark, err := p.db.find(p.query, &docs)
+	if err != nil {
+		return nil, false, err
+	}
+	p.query.Bookmark = bookmark
+	p.done = len(docs) < p.query.Limit
+	return docs, !p.done, nil
+}
+
+// Cursor returns an opaque cursor pointing after the last page returned by
+// Next.
+func (p *Page) Cursor() string {
+	return p.query.Bookmark
+}
+
+// ExpireOlderThan deletes the documents whose timestamp field is older than
+// cutoff, and returns the number of documents deleted. The field must hold
+// RFC 3339 timestamps in UTC, as written by Time and FormatTime. The cutoff
+// is formatted with TimeFormat; timestamps without milliseconds that fall in
+// the same second as the cutoff sort after it, so they are kept.
+func (db *DB) ExpireOlderThan(field string, cutoff time.Time) (int, error) {
+	query := Query{Selector: map[string]interface{}{
+		field: map[string]interface{}{"$lt": FormatTime(cutoff)},
+	}}
+	return db.DeleteByQuery(query)
+}
@@ -0,0 +1,166 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginateDefaultPageSize(t *testing.T) {
+	t.Log("Testing pagination without a page size")
+	calls := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"docs":[{"_id":"a"},{"_id":"b"}],"bookmark":"b"}`)),
+			Request:    req,
+		}, nil
+	})
+	c := newTestClient(t, rt)
+
+	p := c.DB("db").Paginate(Query{}, 0)
+	docs, more, err := p.Next()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 2)
+	assert.False(t, more, "A short page should be the last one")
+	_, more, _ = p.Next()
+	assert.False(t, more)
+	assert.Equal(t, 1, calls)
+}
+
+func TestExpireOlderThanCutoff(t *testing.T) {
+	t.Log("Testing the cutoff of ExpireOlderThan")
+	var body string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body = string(data)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"docs":[]}`)),
+			Request:    req,
+		}, nil
+	})
+	c := newTestClient(t, rt)
+
+	cutoff := time.Date(2017, 1, 2, 3, 4, 5, 5e8, time.UTC)
+	deleted, err := c.DB("db").ExpireOlderThan("created", cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	assert.Contains(t, body, `{"created":{"$lt":"2017-01-02T03:04:05.500Z"}}`)
+
+	// Mango compares the timestamps as strings.
+	lt := FormatTime(cutoff)
+	assert.True(t, "2017-01-02T03:04:04Z" < lt)
+	assert.True(t, "2017-01-02T03:04:05.499Z" < lt)
+	assert.False(t, "2017-01-02T03:04:05.500Z" < lt)
+	assert.False(t, "2017-01-02T03:04:05Z" < lt, "Timestamps without milliseconds in the cutoff second should be kept")
+	assert.False(t, "2017-01-02T03:04:06Z" < lt)
+}
+
+func TestStrictIndexesOncePerQuery(t *testing.T) {
+	t.Log("Testing strict index checks run once per query")
+	calls := make(map[string]int)
+	finds := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls[req.Method+" "+req.URL.Path]++
+		body := `{}`
+		switch req.URL.Path {
+		case "/db/_explain":
+			body = `{"index":{"name":"by-type","type":"json"}}`
+		case "/db/_index":
+			body = `{"indexes":[{"name":"by-type","type":"json","def":{"fields":[{"type":"asc"}]}}]}`
+		case "/db/_find":
+			// Two full pages, then a short one.
+			var query Query
+			json.NewDecoder(req.Body).Decode(&query)
+			finds++
+			n := query.Limit
+			if finds%3 == 0 {
+				n--
+			}
+			docs := make([]map[string]string, n)
+			for i := range docs {
+				docs[i] = map[string]string{"_id": fmt.Sprint(i), "_rev": "1-a"}
+			}
+			data, _ := json.Marshal(map[string]interface{}{"docs": docs, "bookmark": "b"})
+			body = string(data)
+		case "/db/_bulk_docs":
+			body = `[]`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt, WithStrictIndexes()).DB("db")
+	query := Query{Selector: map[string]interface{}{"type": "a"}, Limit: 2}
+	query.Sort = []interface{}{"type"}
+
+	assert.NoError(t, db.FindEach(query, func(json.RawMessage) error { return nil }))
+	count, err := db.Count(query)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*queryPageSize-1, count)
+	p := db.Paginate(query, 2)
+	for more := true; more; {
+		_, more, err = p.Next()
+		assert.NoError(t, err)
+	}
+	_, err = db.DeleteByQuery(query)
+	assert.NoError(t, err)
+	assert.True(t, calls["POST /db/_find"] > 8, "Queries should span several pages")
+	assert.Equal(t, 4, calls["POST /db/_explain"], "Each query should be checked once")
+	assert.Equal(t, 4, calls["GET /db/_index"], "Each sort should be checked once")
+}
+
+func TestDeleteByQueryLimit(t *testing.T) {
+	t.Log("Testing delete by query stops at the limit of the query")
+	var limits []int
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body struct {
+			Limit int           `json:"limit"`
+			Docs  []interface{} `json:"docs"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		var data []byte
+		if req.URL.Path == "/db/_find" {
+			// Every page is full: more documents match than the limit.
+			limits = append(limits, body.Limit)
+			docs := make([]map[string]string, body.Limit)
+			for i := range docs {
+				docs[i] = map[string]string{"_id": fmt.Sprint(i), "_rev": "1-a"}
+			}
+			data, _ = json.Marshal(map[string]interface{}{"docs": docs, "bookmark": "b"})
+		} else {
+			results := make([]BulkResult, len(body.Docs))
+			for i := range results {
+				results[i].OK = true
+			}
+			data, _ = json.Marshal(results)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(string(data))),
+			Request:    req,
+		}, nil
+	})
+	db := newTestClient(t, rt).DB("db")
+
+	deleted, err := db.DeleteByQuery(Query{Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Equal(t, []int{3}, limits)
+
+	limits = nil
+	deleted, err = db.DeleteByQuery(Query{Limit: queryPageSize + 50})
+	assert.NoError(t, err)
+	assert.Equal(t, queryPageSize+50, deleted)
+	assert.Equal(t, []int{queryPageSize, 50}, limits, "Documents should be fetched in pages of 200")
+}
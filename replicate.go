@@ -0,0 +1,207 @@
+package cloudant
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ReplicateOptions configures PullReplicate.
+type ReplicateOptions struct {
+	// BatchSize is the number of changes processed per round-trip.
+	// It defaults to 100.
+	BatchSize int
+	// CheckpointID is the id of the _local document in the target database
+	// holding the last replicated sequence. It defaults to an id derived
+	// from the source and target database URLs.
+	CheckpointID string
+}
+
+type checkpoint struct {
+	ID      string          `json:"_id"`
+	Rev     string          `json:"_rev,omitempty"`
+	LastSeq json.RawMessage `json:"last_seq,omitempty"`
+}
+
+type changeRev struct {
+	Rev string `json:"rev"`
+}
+
+type changesResult struct {
+	Results []struct {
+		ID      string          `json:"id"`
+		Seq     json.RawMessage `json:"seq"`
+		Changes []changeRev     `json:"changes"`
+	} `json:"results"`
+	LastSeq json.RawMessage `json:"last_seq"`
+}
+
+// PullReplicate copies the documents of sourceDB into targetDB on
+// targetClient, which may be a different server, by driving the changes
+// feed itself rather than relying on the _replicator database. The last
+// replicated sequence is checkpointed in a _local document of the target
+// database, so that an interrupted replication resumes where it stopped.
+// Document histories are preserved, so conflicts are replicated as well.
+func (c *Client) PullReplicate(sourceDB string, targetClient *Client, targetDB string, opts ReplicateOptions) error {
+	source := c.DB(sourceDB)
+	target, err := targetClient.EnsureDB(targetDB)
+	if err != nil {
+		return err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.CheckpointID == "" {
+		sum := md5.Sum([]byte(source.path + "\n" + target.path))
+		opts.CheckpointID = "pull-replicate-" + hex.EncodeToString(sum[:])
+	}
+
+	cp := checkpoint{ID: "_local/" + opts.CheckpointID}
+	req := request.New().
+		SetBasicAuth(target.username, target.password).
+		Get(target.path + "/" + cp.ID)
+	if err := targetClient.end(req, &cp); err != nil && !IsNotFound(err) {
+		return err
+	}
+	for {
+		var changes changesResult
+		req = request.New().
+			SetBasicAuth(source.username, source.password).
+			Get(source.path+"/_changes").
+			Param("style", "all_docs").
+			Param("limit", strconv.Itoa(opts.BatchSize))
+		if len(cp.LastSeq) > 0 {
+			req.Param("since", seqString(cp.LastSeq))
+		}
+		if err := c.end(req, &changes); err != nil {
+			return err
+		}
+		if len(changes.Results) == 0 {
+			return nil
+		}
+
+		revs := make(map[string][]string)
+		for _, change := range changes.Results {
+			for _, rev := range change.Changes {
+				revs[change.ID] = append(revs[change.ID], rev.Rev)
+			}
+		}
+		missing, err := target.revsDiff(revs)
+		if err != nil {
+			return err
+		}
+		docs, err := source.bulkGetRevs(missing)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			if err := target.bulkDocsNoNewEdits(docs); err != nil {
+				return err
+			}
+		}
+
+		cp.LastSeq = changes.LastSeq
+		var saved BulkResult
+		req = request.New().
+			SetBasicAuth(target.username, target.password).
+			Put(target.path + "/" + cp.ID).
+			Send(cp)
+		if err := targetClient.end(req, &saved); err != nil {
+			return err
+		}
+		cp.Rev = saved.Rev
+		if len(changes.Results) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// seqString returns the form of a sequence used in query parameters.
+// Sequences are strings on CouchDB 2 and Cloudant, and numbers before.
+func seqString(seq json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(seq, &s); err == nil {
+		return s
+	}
+	return string(seq)
+}
+
+// revsDiff returns, for each document id, the revisions in revs that are
+// missing from the database.
+func (db *DB) revsDiff(revs map[string][]string) (map[string][]string, error) {
+	var data map[string]struct {
+		Missing []string `json:"missing"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_revs_diff").
+		Send(revs)
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	missing := make(map[string][]string)
+	for id, diff := range data {
+		if len(diff.Missing) > 0 {
+			missing[id] = diff.Missing
+		}
+	}
+	return missing, nil
+}
+
+// bulkGetRevs fetches the given revisions of documents, along with their
+// revision histories and the content of their attachments, in a single
+// _bulk_get request.
+func (db *DB) bulkGetRevs(revs map[string][]string) ([]interface{}, error) {
+	if len(revs) == 0 {
+		return nil, nil
+	}
+	var refs []BulkGetRef
+	for id, list := range revs {
+		for _, rev := range list {
+			refs = append(refs, BulkGetRef{id, rev})
+		}
+	}
+	results, err := db.BulkGet(refs, BulkGetOptions{Revs: true, Attachments: true})
+	if err != nil {
+		return nil, err
+	}
+	var docs []interface{}
+	bulkErr := &BulkError{}
+	for _, result := range results {
+		if result.Error != nil {
+			bulkErr.Docs = append(bulkErr.Docs, *result.Error)
+			continue
+		}
+		docs = append(docs, result.Doc)
+	}
+	if len(bulkErr.Docs) > 0 {
+		return nil, bulkErr
+	}
+	return docs, nil
+}
+
+// bulkDocsNoNewEdits writes docs with new_edits=false, storing the given
+// revisions as they are instead of generating new ones.
+func (db *DB) bulkDocsNoNewEdits(docs []interface{}) error {
+	var results []BulkResult
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + "/_bulk_docs").
+		Send(map[string]interface{}{"docs": docs, "new_edits": false})
+	if err := db.client.end(req, &results); err != nil {
+		return err
+	}
+	bulkErr := &BulkError{}
+	for _, result := range results {
+		if result.Error != "" {
+			bulkErr.Docs = append(bulkErr.Docs, DocError{result.ID, result.Error, result.Reason})
+		}
+	}
+	if len(bulkErr.Docs) > 0 {
+		return bulkErr
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// docPath returns the path of the document id within its database. The id
+// is escaped, except for the slash after the prefix of design and local
+// documents.
+func docPath(id string) string {
+	for _, prefix := range []string{"_design/", "_local/"} {
+		if strings.HasPrefix(id, prefix) {
+			return prefix + url.PathEscape(id[len(prefix):])
+		}
+	}
+	return url.PathEscape(id)
+}
+
+// do sends req through the client's transport. The caller must close the
+// response body.
+func (c *Client) do(req *request.SuperAgent) (*http.Response, error) {
+	if len(req.Errors) != 0 {
+		return nil, req.Errors[0]
+	}
+	httpReq, err := req.MakeRequest()
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+// send sends req through the client's transport and returns the response
+// along with its body.
+func (c *Client) send(req *request.SuperAgent) (*http.Response, []byte, error) {
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// end sends req and decodes a successful JSON response into v, which may be
+// nil. Failed responses are returned as *couchdb.Error.
+func (c *Client) end(req *request.SuperAgent, v interface{}) error {
+	resp, body, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	if err := responseError(resp, body); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// stream sends req and returns a successful response with its body unread,
+// for the caller to close. Failed responses are returned as *couchdb.Error.
+func (c *Client) stream(req *request.SuperAgent) (*http.Response, error) {
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, responseError(resp, body)
+	}
+	return resp, nil
+}
+
+// setOptions adds opts to the query parameters of req. Keys are JSON
+// encoded, as is done by the couchdb client.
+func setOptions(req *request.SuperAgent, opts Options) error {
+	for k, v := range opts {
+		switch k {
+		case "key", "keys", "startkey", "start_key", "endkey", "end_key":
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			req.Param(k, string(data))
+		default:
+			req.Param(k, fmt.Sprint(v))
+		}
+	}
+	return nil
+}
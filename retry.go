@@ -0,0 +1,157 @@
+package cloudant
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// retryBaseDelay is the delay before the first retry of a request. It
+// doubles with each retry.
+const retryBaseDelay = 100 * time.Millisecond
+
+// RetryPredicate tells whether a request that got resp or err should be
+// retried.
+type RetryPredicate func(req *http.Request, resp *http.Response, err error) bool
+
+// DefaultRetryPredicate retries idempotent requests failing with a network
+// error, a 429 or a 5xx response. POST requests are never retried.
+func DefaultRetryPredicate(req *http.Request, resp *http.Response, err error) bool {
+	if !isIdempotent(req.Method) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryTransport retries requests for which retryIf is true, or
+// DefaultRetryPredicate if it is nil, up to retries times. Retries wait for
+// the Retry-After delay of the response if given, and back off
+// exponentially otherwise. If budget is not nil, each retry takes a token
+// from it, and failures are returned as is once it is exhausted. Requests
+// failed by the circuit breaker are never retried.
+type retryTransport struct {
+	retries int
+	budget  *retryBudget
+	retryIf RetryPredicate
+	rt      http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryIf := t.retryIf
+	if retryIf == nil {
+		retryIf = DefaultRetryPredicate
+	}
+	// Buffer the body so that it can be sent again. Bodies of unknown
+	// length are streamed, and can't be retried.
+	var body []byte
+	if hasBody(req) {
+		if req.ContentLength <= 0 {
+			return t.rt.RoundTrip(req)
+		}
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		r := req
+		if body != nil {
+			r = new(http.Request)
+			*r = *req
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.rt.RoundTrip(r)
+		if attempt == t.retries || err == ErrCircuitOpen || !retryIf(r, resp, err) || (t.budget != nil && !t.budget.take()) {
+			return resp, err
+		}
+		wait := delay
+		if resp != nil {
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+// hasBody tells whether req has content to send. Requests built by
+// gorequest without content get an empty http.NoBody body. Other bodies
+// with a ContentLength of zero have an unknown length, as in net/http.
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
+
+// isIdempotent tells whether requests with the given method can be sent
+// again safely.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay given in the Retry-After header of resp.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(time.Now()), true
+	}
+	return 0, false
+}
+
+// retryBudget is a token bucket capping the rate of retries across all the
+// requests of a client. It holds up to size tokens, and refills at rate
+// tokens per second.
+type retryBudget struct {
+	size float64
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRetryBudget(size int, rate float64) *retryBudget {
+	return &retryBudget{size: float64(size), rate: rate, tokens: float64(size), last: time.Now()}
+}
+
+// take takes a token from the budget, and tells whether one was left.
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.size {
+		b.tokens = b.size
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,193 @@
+package cloudant
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryTransport(t *testing.T) {
+	t.Log("Testing retry transport")
+	var bodies []string
+	rt := &retryTransport{
+		retries: 3,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ := ioutil.ReadAll(req.Body)
+			bodies = append(bodies, string(body))
+			if len(bodies) < 3 {
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     http.Header{"Retry-After": {"0"}},
+					Body:       ioutil.NopCloser(strings.NewReader("{}")),
+				}, nil
+			}
+			return okResponse(req)
+		}),
+	}
+	req, _ := http.NewRequest("PUT", "https://example.com/db/doc", strings.NewReader(`{"a":1}`))
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`{"a":1}`, `{"a":1}`, `{"a":1}`}, bodies)
+
+	bodies = nil
+	req, _ = http.NewRequest("POST", "https://example.com/db", strings.NewReader(`{"a":1}`))
+	resp, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "POST requests should not be retried")
+	assert.Len(t, bodies, 1)
+}
+
+func TestRetryGoRequest(t *testing.T) {
+	t.Log("Testing retries of requests built with gorequest")
+	calls := 0
+	rt := &retryTransport{
+		retries: 3,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       ioutil.NopCloser(strings.NewReader("{}")),
+			}, nil
+		}),
+	}
+	url := "https://example.com/db"
+	for _, agent := range []*request.SuperAgent{request.New().Get(url), request.New().Head(url), request.New().Delete(url)} {
+		calls = 0
+		req, err := agent.MakeRequest()
+		assert.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, calls, req.Method+" request should be retried")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Log("Testing retry budget")
+	calls := 0
+	rt := &retryTransport{
+		retries: 5,
+		budget:  newRetryBudget(2, 0),
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return nil, errors.New("connection refused")
+		}),
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/db", nil)
+	_, err := rt.RoundTrip(req)
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls, "Retries should stop when the budget is exhausted")
+
+	calls = 0
+	_, err = rt.RoundTrip(req)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "Failures should pass through with an empty budget")
+}
+
+func TestRetryPredicate(t *testing.T) {
+	t.Log("Testing retry transport with custom predicate")
+	calls := 0
+	rt := &retryTransport{
+		retries: 3,
+		retryIf: func(req *http.Request, resp *http.Response, err error) bool {
+			return strings.HasSuffix(req.URL.Path, "/_find") && resp.StatusCode == http.StatusServiceUnavailable
+		},
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls < 2 {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{"Retry-After": {"0"}},
+					Body:       ioutil.NopCloser(strings.NewReader("{}")),
+				}, nil
+			}
+			return okResponse(req)
+		}),
+	}
+	req, _ := http.NewRequest("POST", "https://example.com/db/_find", strings.NewReader(`{}`))
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "POST _find should be retried by the predicate")
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	req, _ = http.NewRequest("GET", "https://example.com/db/doc", nil)
+	resp, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "GET should not be retried by the predicate")
+	assert.Equal(t, 1, calls)
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	t.Log("Testing service unavailable errors")
+	calls := 0
+	rt := &retryTransport{
+		retries: 2,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"service_unavailable"}`)),
+				Request:    req,
+			}, nil
+		}),
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/db", nil)
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls, "503 responses should be retried")
+
+	resp.Header.Set("Retry-After", "30")
+	body, _ := ioutil.ReadAll(resp.Body)
+	err = responseError(resp, body)
+	assert.True(t, IsUnavailable(err))
+	if unavailable, ok := err.(*ServiceUnavailableError); assert.True(t, ok) {
+		assert.Equal(t, 30*time.Second, unavailable.RetryAfter)
+		assert.Equal(t, "service_unavailable", unavailable.Err.ErrorCode)
+	}
+}
+
+func TestServiceUnavailableRetryAfter(t *testing.T) {
+	t.Log("Testing retries of 503 responses with Retry-After")
+	calls := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": {"1"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"service_unavailable"}`)),
+				Request:    req,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"db_name":"db"}`)),
+			Request:    req,
+		}, nil
+	})
+	c := newTestClient(t, &retryTransport{retries: 1, rt: rt})
+
+	start := time.Now()
+	info, err := c.DB("db").Info()
+	assert.NoError(t, err, "503 should be retried")
+	assert.Equal(t, "db", info.DBName)
+	assert.Equal(t, 2, calls)
+	assert.True(t, time.Since(start) >= time.Second, "Retry-After should be honored")
+
+	calls = 0
+	c.transport.(*retryTransport).retries = 0
+	_, err = c.DB("db").Info()
+	assert.True(t, IsUnavailable(err))
+	if unavailable, ok := err.(*ServiceUnavailableError); assert.True(t, ok) {
+		assert.Equal(t, time.Second, unavailable.RetryAfter)
+	}
+}
@@ -0,0 +1,118 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	couchdb "github.com/timjacobi/go-couchdb"
+)
+
+// Revisions is the revision history of a document, newest first, as
+// returned in the _revisions field when requesting revs=true.
+type Revisions struct {
+	Start int      `json:"start"`
+	IDs   []string `json:"ids"`
+}
+
+// Revs returns the full revision strings of the history, newest first.
+func (r *Revisions) Revs() []string {
+	revs := make([]string, len(r.IDs))
+	for i, id := range r.IDs {
+		revs[i] = strconv.Itoa(r.Start-i) + "-" + id
+	}
+	return revs
+}
+
+// GetDocumentWithRevisions decodes the document into doc like GetDocument,
+// and also returns its revision history. The history is needed to write
+// the document elsewhere with new_edits=false while preserving ancestry.
+func (db *DB) GetDocumentWithRevisions(id string, doc interface{}, opts Options) (*Revisions, error) {
+	revOpts := couchdb.Options{"revs": true}
+	for k, v := range opts {
+		revOpts[k] = v
+	}
+	var raw json.RawMessage
+	if err := db.Get(id, &raw, revOpts); err != nil {
+		return nil, err
+	}
+	var data struct {
+		Revisions *Revisions `json:"_revisions"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	if err := db.unmarshal(raw, doc); err != nil {
+		return nil, err
+	}
+	return data.Revisions, nil
+}
+
+// RevInfo is the availability of a revision of a document.
+type RevInfo struct {
+	Rev    string `json:"rev"`
+	Status string `json:"status"`
+}
+
+// DocumentMeta is the conflict and revision information of a document, as
+// returned when requesting meta=true.
+type DocumentMeta struct {
+	Conflicts        []string  `json:"_conflicts"`
+	DeletedConflicts []string  `json:"_deleted_conflicts"`
+	RevsInfo         []RevInfo `json:"_revs_info"`
+}
+
+// GetDocumentMeta decodes the document into doc like GetDocument, and also
+// returns its conflicts, deleted conflicts and revisions info, fetched in
+// the same request.
+func (db *DB) GetDocumentMeta(id string, doc interface{}) (*DocumentMeta, error) {
+	var raw json.RawMessage
+	if err := db.Get(id, &raw, couchdb.Options{"meta": true}); err != nil {
+		return nil, err
+	}
+	meta := &DocumentMeta{}
+	if err := json.Unmarshal(raw, meta); err != nil {
+		return nil, err
+	}
+	if err := db.unmarshal(raw, doc); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// ParseRev splits a revision of the form "gen-hash" into its generation
+// and hash.
+func ParseRev(rev string) (gen int, hash string, err error) {
+	i := strings.IndexByte(rev, '-')
+	if i < 0 {
+		return 0, "", errors.New("Invalid revision: " + rev)
+	}
+	if gen, err = strconv.Atoi(rev[:i]); err != nil || gen < 1 || i == len(rev)-1 {
+		return 0, "", errors.New("Invalid revision: " + rev)
+	}
+	return gen, rev[i+1:], nil
+}
+
+// CompareRevs returns -1, 0 or 1 if revision a is older than, the same as,
+// or newer than revision b. Revisions are ordered by generation, then by
+// hash, the way CouchDB picks the winner among conflicting revisions.
+// Invalid revisions are older than valid ones.
+func CompareRevs(a, b string) int {
+	genA, hashA, errA := ParseRev(a)
+	genB, hashB, errB := ParseRev(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	case genA != genB:
+		if genA < genB {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(hashA, hashB)
+}
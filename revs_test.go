@@ -0,0 +1,30 @@
+package cloudant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRev(t *testing.T) {
+	t.Log("Testing revision parsing")
+	gen, hash, err := ParseRev("12-967a00dff5e02add41819138abb3284d")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, gen)
+	assert.Equal(t, "967a00dff5e02add41819138abb3284d", hash)
+
+	for _, rev := range []string{"", "abc", "0-abc", "x-abc", "3-"} {
+		_, _, err := ParseRev(rev)
+		assert.Error(t, err, "Unexpected success parsing %q", rev)
+	}
+}
+
+func TestCompareRevs(t *testing.T) {
+	t.Log("Testing revision comparison")
+	assert.Equal(t, -1, CompareRevs("2-abc", "10-abc"))
+	assert.Equal(t, 1, CompareRevs("10-abc", "2-abc"))
+	assert.Equal(t, 0, CompareRevs("3-abc", "3-abc"))
+	assert.Equal(t, -1, CompareRevs("3-abc", "3-abd"))
+	assert.Equal(t, -1, CompareRevs("invalid", "1-abc"))
+	assert.Equal(t, 1, CompareRevs("1-abc", "invalid"))
+}
@@ -0,0 +1,67 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ReplicationError is an error met by a replication.
+type ReplicationError struct {
+	Time time.Time
+	// State is the state of the replication after the error, such as
+	// "crashing" or "failed", or "crashed" for past errors.
+	State  string
+	Reason string
+}
+
+// ReplicationErrors returns the errors met by the replication defined by
+// the document docID of the _replicator database, most recent first. The
+// crash history of the replication job is returned when the job is
+// running. Otherwise only the last error is known.
+func (c *Client) ReplicationErrors(docID string) ([]ReplicationError, error) {
+	var doc struct {
+		JobID *string `json:"id"`
+		State string  `json:"state"`
+		Info  struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"info"`
+		LastUpdated time.Time `json:"last_updated"`
+	}
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Get(c.Client.URL() + "/_scheduler/docs/_replicator/" + docID)
+	if err := c.end(req, &doc); err != nil {
+		return nil, err
+	}
+
+	var errs []ReplicationError
+	if doc.JobID != nil {
+		var job struct {
+			History []struct {
+				Timestamp time.Time `json:"timestamp"`
+				Type      string    `json:"type"`
+				Reason    string    `json:"reason"`
+			} `json:"history"`
+		}
+		req := request.New().
+			SetBasicAuth(c.username, c.password).
+			Get(c.Client.URL() + "/_scheduler/jobs/" + *doc.JobID)
+		if err := c.end(req, &job); err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		for _, event := range job.History {
+			if event.Type == "crashed" {
+				errs = append(errs, ReplicationError{event.Timestamp, event.Type, event.Reason})
+			}
+		}
+	}
+	if len(errs) == 0 && len(doc.Info.Error) > 0 && string(doc.Info.Error) != "null" {
+		// The error is usually a string, but is kept as JSON otherwise.
+		reason := string(doc.Info.Error)
+		json.Unmarshal(doc.Info.Error, &reason)
+		errs = append(errs, ReplicationError{doc.LastUpdated, doc.State, reason})
+	}
+	return errs, nil
+}
@@ -0,0 +1,83 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"strconv"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// SearchOptions configures a search on an index defined in a design
+// document.
+type SearchOptions struct {
+	// Bookmark continues a previous search from where it stopped.
+	Bookmark string
+	// Limit is the maximum number of results, if not zero.
+	Limit int
+	// Sort is the sort order, as a JSON string such as `["-created"]`.
+	Sort string
+}
+
+// SearchInto searches an index defined in the design document, and decodes
+// the matching documents into out, which must be a pointer to a slice. It
+// returns the bookmark of the next page of results.
+func (ddoc *DesignDocument) SearchInto(db *DB, index, query string, opts SearchOptions, out interface{}) (string, error) {
+	path := "/" + ddoc.ID + "/_search/" + index
+	var data struct {
+		Bookmark string `json:"bookmark"`
+		Rows     []struct {
+			Doc json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path+path).
+		Param("query", query).
+		Param("include_docs", "true")
+	opts.setParams(req)
+	if err := db.client.end(req, &data); err != nil {
+		return "", bookmarkError(err, opts.Bookmark)
+	}
+	docs := make([]json.RawMessage, len(data.Rows))
+	for i, row := range data.Rows {
+		docs[i] = row.Doc
+	}
+	list, err := json.Marshal(docs)
+	if err != nil {
+		return "", err
+	}
+	if err := db.unmarshal(list, out); err != nil {
+		return "", err
+	}
+	return data.Bookmark, nil
+}
+
+// SearchInPartition searches a partitioned index defined in the design
+// document, within a single partition of the database. The server returns
+// an error if the index is not partitioned.
+func (ddoc *DesignDocument) SearchInPartition(db *DB, partitionKey, index, query string, opts SearchOptions) (*SearchResp, error) {
+	path := "/_partition/" + partitionKey + "/" + ddoc.ID + "/_search/" + index
+	body := &SearchResp{}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path+path).
+		Param("query", query)
+	opts.setParams(req)
+	if err := db.client.end(req, body); err != nil {
+		return nil, bookmarkError(err, opts.Bookmark)
+	}
+	return body, nil
+}
+
+// setParams sets the query parameters of a search request.
+func (opts SearchOptions) setParams(req *request.SuperAgent) {
+	if opts.Bookmark != "" {
+		req.Param("bookmark", opts.Bookmark)
+	}
+	if opts.Limit > 0 {
+		req.Param("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Sort != "" {
+		req.Param("sort", opts.Sort)
+	}
+}
@@ -0,0 +1,47 @@
+package cloudant
+
+import (
+	request "github.com/parnurzeal/gorequest"
+)
+
+// SecurityMembers lists the users and roles of a security section.
+type SecurityMembers struct {
+	Names []string `json:"names,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Security is the security document of a database.
+// Cloudant doc: https://console.bluemix.net/docs/services/Cloudant/api/authorization.html
+type Security struct {
+	// Admins and Members are the CouchDB style permissions, used when
+	// CouchDBAuthOnly is set.
+	Admins  *SecurityMembers `json:"admins,omitempty"`
+	Members *SecurityMembers `json:"members,omitempty"`
+	// Cloudant maps API keys and users, or "nobody" for unauthenticated
+	// access, to their roles such as "_reader", "_writer" and "_admin".
+	Cloudant map[string][]string `json:"cloudant,omitempty"`
+	// CouchDBAuthOnly makes the database use the CouchDB style permissions
+	// instead of the Cloudant ones.
+	CouchDBAuthOnly *bool `json:"couchdb_auth_only,omitempty"`
+}
+
+// GetSecurity returns the security document of the database.
+func (db *DB) GetSecurity() (*Security, error) {
+	security := &Security{}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + "/_security")
+	if err := db.client.end(req, security); err != nil {
+		return nil, err
+	}
+	return security, nil
+}
+
+// SetSecurity replaces the security document of the database.
+func (db *DB) SetSecurity(security *Security) error {
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Put(db.path + "/_security").
+		Send(security)
+	return db.client.end(req, nil)
+}
@@ -0,0 +1,50 @@
+package cloudant
+
+import (
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ThroughputRates counts operations per second by class: reads are
+// lookups of documents by id, queries are view, search and Mango queries.
+type ThroughputRates struct {
+	Read  int `json:"read"`
+	Write int `json:"write"`
+	Query int `json:"query"`
+}
+
+// Throughput is the request rate of an IBM Cloudant account, against the
+// capacity of its plan.
+type Throughput struct {
+	// Usage is the number of operations of the current second.
+	Usage ThroughputRates
+	// Limits is the provisioned capacity, beyond which requests are
+	// rejected with 429.
+	Limits ThroughputRates
+}
+
+// ThroughputUsage returns the current request rate of the account and the
+// capacity of its plan, for the client to slow down before it is rate
+// limited. It is only available on IBM Cloudant.
+func (c *Client) ThroughputUsage() (Throughput, error) {
+	var usage struct {
+		Throughput ThroughputRates `json:"throughput"`
+	}
+	req := request.New().
+		SetBasicAuth(c.username, c.password).
+		Get(c.Client.URL() + "/_api/v2/user/current/throughput")
+	if err := c.end(req, &usage); err != nil {
+		return Throughput{}, err
+	}
+	var capacity struct {
+		Current struct {
+			Throughput ThroughputRates `json:"throughput"`
+		} `json:"current"`
+	}
+	req = request.New().
+		SetBasicAuth(c.username, c.password).
+		Get(c.Client.URL() + "/_api/v2/user/capacity/throughput")
+	if err := c.end(req, &capacity); err != nil {
+		return Throughput{}, err
+	}
+	return Throughput{Usage: usage.Throughput, Limits: capacity.Current.Throughput}, nil
+}
@@ -0,0 +1,41 @@
+package cloudant
+
+import (
+	"time"
+)
+
+// TimeFormat is the layout used by Time and FormatTime. Timestamps are
+// written in UTC with a fixed number of fractional digits, so that their
+// lexicographic order is their time order, and Mango range queries such as
+// $lt and $gte compare them correctly.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatTime formats t with TimeFormat, for use in documents and selectors.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Time is a time.Time stored in documents in the TimeFormat layout. Use it
+// for the time fields of document structs that are queried by range.
+type Time struct {
+	time.Time
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + FormatTime(t.Time) + `"`), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Any RFC 3339 timestamp is
+// accepted.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	parsed, err := time.Parse(`"`+time.RFC3339Nano+`"`, string(data))
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
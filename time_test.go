@@ -0,0 +1,28 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTime(t *testing.T) {
+	t.Log("Testing time round-trip")
+	local := time.FixedZone("UTC+2", 2*60*60)
+	var doc struct {
+		Created Time `json:"created"`
+	}
+	doc.Created = Time{time.Date(2017, 1, 2, 3, 4, 5, 0, local)}
+	data, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"created":"2017-01-02T01:04:05.000Z"}`, string(data))
+
+	doc.Created = Time{}
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.True(t, doc.Created.Equal(time.Date(2017, 1, 2, 1, 4, 5, 0, time.UTC)))
+
+	assert.True(t, FormatTime(time.Unix(9, 0)) < FormatTime(time.Unix(10, 0)))
+	assert.True(t, FormatTime(time.Unix(0, 1e8)) < FormatTime(time.Unix(1, 0)))
+}
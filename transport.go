@@ -0,0 +1,231 @@
+package cloudant
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// newTransport returns a transport with the settings of
+// http.DefaultTransport, so that each client owns its connections.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// limitTransport bounds the number of requests in flight at once. A request
+// holds its slot until its response body is closed, and requests beyond the
+// limit wait for a slot to be released. Feed requests don't take a slot,
+// since they stay open for as long as the feed is read.
+type limitTransport struct {
+	sem chan struct{}
+	rt  http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isFeed(req) {
+		return t.rt.RoundTrip(req)
+	}
+	select {
+	case t.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		<-t.sem
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { <-t.sem }}
+	return resp, nil
+}
+
+// isFeed tells whether req reads a continuous or long polling changes feed.
+func isFeed(req *http.Request) bool {
+	switch req.URL.Query().Get("feed") {
+	case "continuous", "longpoll", "eventsource":
+		return true
+	}
+	return false
+}
+
+// releaseBody calls release once when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// defaultsTransport adds default headers and query parameters to requests
+// that don't set them already.
+type defaultsTransport struct {
+	header http.Header
+	query  url.Values
+	rt     http.RoundTripper
+}
+
+func (t *defaultsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+len(t.header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	for k, v := range t.header {
+		if _, ok := r.Header[k]; !ok {
+			r.Header[k] = v
+		}
+	}
+	if len(t.query) > 0 {
+		u := *req.URL
+		q := u.Query()
+		for k, v := range t.query {
+			if _, ok := q[k]; !ok {
+				q[k] = v
+			}
+		}
+		u.RawQuery = q.Encode()
+		r.URL = &u
+	}
+	return t.rt.RoundTrip(r)
+}
+
+// ErrCircuitOpen is returned for requests failed by the circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// breakerTransport fails requests immediately after threshold consecutive
+// failures, until cooldown has elapsed. It then lets a single request
+// through, and closes the circuit if it succeeds. Requests canceled by
+// their context are neither failures nor successes.
+type breakerTransport struct {
+	threshold int
+	cooldown  time.Duration
+	rt        http.RoundTripper
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe := false
+	t.mu.Lock()
+	if t.failures >= t.threshold {
+		if t.probing || time.Now().Before(t.openUntil) {
+			t.mu.Unlock()
+			return nil, ErrCircuitOpen
+		}
+		t.probing = true
+		probe = true
+	}
+	t.mu.Unlock()
+
+	resp, err := t.rt.RoundTrip(req)
+
+	t.mu.Lock()
+	if probe {
+		t.probing = false
+	}
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// The caller gave up on the request, which says nothing about the
+		// server.
+	case err != nil || resp.StatusCode >= 500:
+		t.failures++
+		if t.failures >= t.threshold {
+			t.openUntil = time.Now().Add(t.cooldown)
+		}
+	default:
+		t.failures = 0
+	}
+	t.mu.Unlock()
+	return resp, err
+}
+
+// hedgeTransport sends a second copy of a GET request if no response was
+// received after delay, and returns the first successful response. The
+// other request is canceled.
+type hedgeTransport struct {
+	delay time.Duration
+	rt    http.RoundTripper
+}
+
+type hedgeResult struct {
+	i    int
+	resp *http.Response
+	err  error
+}
+
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || hasBody(req) {
+		return t.rt.RoundTrip(req)
+	}
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.rt.RoundTrip(req.WithContext(ctx))
+			results <- hedgeResult{i, resp, err}
+		}()
+	}
+	send()
+	pending := 1
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			send()
+			pending++
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				cancels[r.i]()
+				if pending > 0 {
+					continue
+				}
+				return nil, r.err
+			}
+			// The request of the response is canceled once its body is
+			// closed, and the other request right away.
+			for i, cancel := range cancels {
+				if i != r.i {
+					cancel()
+				}
+			}
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					if r := <-results; r.err == nil {
+						r.resp.Body.Close()
+					}
+				}
+			}(pending)
+			r.resp.Body = &releaseBody{ReadCloser: r.resp.Body, release: cancels[r.i]}
+			return r.resp, nil
+		}
+	}
+}
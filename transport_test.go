@@ -0,0 +1,335 @@
+package cloudant
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	request "github.com/parnurzeal/gorequest"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func okResponse(*http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+// newTestClient returns a client sending its requests through rt, with opts
+// applied.
+func newTestClient(t *testing.T, rt http.RoundTripper, opts ...ClientOption) *Client {
+	c := &Client{username: "user", password: "pass", transport: rt, httpClient: &http.Client{Transport: rt}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	assert.NoError(t, c.connect())
+	return c
+}
+
+func TestLimitTransportFeed(t *testing.T) {
+	t.Log("Testing feeds don't hold a concurrency slot")
+	pr, pw := io.Pipe()
+	body := &feedBody{PipeReader: pr, closed: make(chan struct{})}
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/db/_changes" {
+			return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+		}
+		return okResponse(req)
+	})
+	c := newTestClient(t, &limitTransport{make(chan struct{}, 1), rt})
+
+	it := c.DB("db").ContinuousChanges(ChangesOptions{})
+	go pw.Write([]byte(`{"seq":"1-a","id":"a","changes":[{"rev":"1-a"}]}` + "\n"))
+	assert.True(t, it.Next())
+
+	done := make(chan error)
+	go func() {
+		_, err := c.DB("db").Info()
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Request blocked by an open feed")
+	}
+	it.Close()
+	<-body.closed
+}
+
+func TestDefaultsTransport(t *testing.T) {
+	t.Log("Testing default headers and query parameters transport")
+	var sent *http.Request
+	rt := &defaultsTransport{
+		header: http.Header{"X-Default": {"1"}, "X-Set": {"default"}},
+		query:  url.Values{"q": {"default"}, "r": {"1"}},
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return okResponse(req)
+		}),
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/db?q=set", nil)
+	req.Header.Set("X-Set", "set")
+	_, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", sent.Header.Get("X-Default"))
+	assert.Equal(t, "set", sent.Header.Get("X-Set"))
+	assert.Equal(t, "set", sent.URL.Query().Get("q"))
+	assert.Equal(t, "1", sent.URL.Query().Get("r"))
+	assert.Equal(t, "", req.Header.Get("X-Default"), "Original request was modified")
+}
+
+func TestBreakerTransport(t *testing.T) {
+	t.Log("Testing circuit breaker transport")
+	fail := true
+	calls := 0
+	rt := &breakerTransport{
+		threshold: 2,
+		cooldown:  50 * time.Millisecond,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if fail {
+				return nil, errors.New("connection refused")
+			}
+			return okResponse(req)
+		}),
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/db", nil)
+	for i := 0; i < 2; i++ {
+		_, err := rt.RoundTrip(req)
+		assert.Error(t, err)
+	}
+	_, err := rt.RoundTrip(req)
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 2, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	fail = false
+	_, err = rt.RoundTrip(req)
+	assert.NoError(t, err, "Probe request should go through after cooldown")
+	_, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+}
+
+func TestBreakerTransportCanceled(t *testing.T) {
+	t.Log("Testing circuit breaker ignores canceled requests")
+	rt := &breakerTransport{
+		threshold: 1,
+		cooldown:  time.Minute,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}),
+	}
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		req, _ := http.NewRequest("GET", "https://example.com/db", nil)
+		_, err := rt.RoundTrip(req.WithContext(ctx))
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err, "Canceled requests should not open the circuit")
+	}
+}
+
+func TestBreakerTransportProbe(t *testing.T) {
+	t.Log("Testing circuit breaker lets a single probe through")
+	release := map[string]chan struct{}{"/slow": make(chan struct{}), "/probe": make(chan struct{})}
+	started := make(chan struct{}, 2)
+	rt := &breakerTransport{
+		threshold: 1,
+		cooldown:  10 * time.Millisecond,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if ch, ok := release[req.URL.Path]; ok {
+				started <- struct{}{}
+				<-ch
+			}
+			return nil, errors.New("connection refused")
+		}),
+	}
+	var wg sync.WaitGroup
+	roundTrip := func(path string) {
+		defer wg.Done()
+		req, _ := http.NewRequest("GET", "https://example.com"+path, nil)
+		rt.RoundTrip(req)
+	}
+	wg.Add(1)
+	go roundTrip("/slow")
+	<-started
+	req, _ := http.NewRequest("GET", "https://example.com/fail", nil)
+	_, err := rt.RoundTrip(req)
+	assert.NotEqual(t, ErrCircuitOpen, err)
+
+	time.Sleep(20 * time.Millisecond)
+	wg.Add(1)
+	go roundTrip("/probe")
+	<-started
+	close(release["/slow"])
+	time.Sleep(20 * time.Millisecond)
+	_, err = rt.RoundTrip(req)
+	assert.Equal(t, ErrCircuitOpen, err, "Only the probe should be let through while it runs")
+
+	close(release["/probe"])
+	wg.Wait()
+}
+
+func TestHedgeTransport(t *testing.T) {
+	t.Log("Testing hedged requests transport")
+	var mu sync.Mutex
+	calls := 0
+	rt := &hedgeTransport{
+		delay: 20 * time.Millisecond,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				// The first request stalls until it is canceled.
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			return okResponse(req)
+		}),
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/db/doc", nil)
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err, "Hedged request should succeed")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	mu.Lock()
+	assert.Equal(t, 2, calls)
+	mu.Unlock()
+
+	calls = 0
+	rt.rt = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		time.Sleep(50 * time.Millisecond)
+		return okResponse(req)
+	})
+	req, _ = http.NewRequest("PUT", "https://example.com/db/doc", strings.NewReader("{}"))
+	_, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "PUT requests should not be hedged")
+}
+
+func TestHedgeGoRequest(t *testing.T) {
+	t.Log("Testing hedging of requests built with gorequest")
+	var mu sync.Mutex
+	calls := 0
+	rt := &hedgeTransport{
+		delay: 20 * time.Millisecond,
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			return okResponse(req)
+		}),
+	}
+	c := newTestClient(t, rt)
+	resp, err := c.do(request.New().Get("https://example.com/db/doc"))
+	assert.NoError(t, err, "Hedged request should succeed")
+	resp.Body.Close()
+	mu.Lock()
+	assert.Equal(t, 2, calls, "GET requests built with gorequest should be hedged")
+	mu.Unlock()
+}
+
+func TestHedgeBreaker(t *testing.T) {
+	t.Log("Testing hedged requests don't trip the circuit breaker")
+	var mu sync.Mutex
+	calls := 0
+	stall := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		calls++
+		first := calls%2 == 1
+		mu.Unlock()
+		if first {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return okResponse(req)
+	})
+	// The breaker wraps the hedging in NewClient, but canceled copies must
+	// not count as failures either way.
+	transports := []http.RoundTripper{
+		&breakerTransport{threshold: 1, cooldown: time.Minute, rt: &hedgeTransport{delay: 5 * time.Millisecond, rt: stall}},
+		&hedgeTransport{delay: 5 * time.Millisecond, rt: &breakerTransport{threshold: 1, cooldown: time.Minute, rt: stall}},
+	}
+	for _, rt := range transports {
+		for i := 0; i < 5; i++ {
+			req, _ := http.NewRequest("GET", "https://example.com/db/doc", nil)
+			resp, err := rt.RoundTrip(req)
+			assert.NoError(t, err, "Hedged requests should not open the circuit")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+}
+
+func TestAdminRequests(t *testing.T) {
+	t.Log("Testing admin operations go through the client transport")
+	var sent []string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		user, _, _ := req.BasicAuth()
+		sent = append(sent, req.Method+" "+req.URL.Path+" "+user)
+		if req.Method == "PUT" {
+			return &http.Response{
+				StatusCode: http.StatusPreconditionFailed,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"file_exists"}`)),
+				Request:    req,
+			}, nil
+		}
+		return okResponse(req)
+	})
+	c := newTestClient(t, rt)
+
+	assert.NoError(t, c.IsAlive())
+	_, err := c.EnsureDB("db")
+	assert.NoError(t, err, "Existing database should be accepted")
+	_, err = c.CreateDB("db")
+	assert.True(t, IsDBExists(err))
+	assert.NoError(t, c.DeleteDB("db"))
+	assert.Equal(t, []string{"HEAD / user", "PUT /db user", "PUT /db user", "DELETE /db user"}, sent)
+}
+
+func TestHealthCheckMissingDatabase(t *testing.T) {
+	t.Log("Testing health check reports a missing database as DatabaseNotFoundError")
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/missing" {
+			return okResponse(req)
+		}
+		body := `{"error":"not_found","reason":"Database does not exist."}`
+		if req.Method == "HEAD" {
+			body = ""
+		}
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	c := newTestClient(t, rt)
+
+	results, err := c.HealthCheck([]string{"db", "missing"})
+	assert.NoError(t, err)
+	assert.NoError(t, results["db"])
+	assert.True(t, IsNotFound(results["missing"]))
+	_, ok := results["missing"].(*DatabaseNotFoundError)
+	assert.True(t, ok, "Missing database should give a DatabaseNotFoundError")
+}
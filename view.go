@@ -0,0 +1,177 @@
+package cloudant
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	request "github.com/parnurzeal/gorequest"
+)
+
+// ViewOptions is a query on a view.
+// Cloudant doc: https://docs.cloudant.com/using_views.html
+type ViewOptions struct {
+	Key         interface{}   `json:"key,omitempty"`
+	Keys        []interface{} `json:"keys,omitempty"`
+	StartKey    interface{}   `json:"startkey,omitempty"`
+	EndKey      interface{}   `json:"endkey,omitempty"`
+	Limit       int           `json:"limit,omitempty"`
+	Skip        int           `json:"skip,omitempty"`
+	Descending  bool          `json:"descending,omitempty"`
+	IncludeDocs bool          `json:"include_docs,omitempty"`
+	Reduce      *bool         `json:"reduce,omitempty"`
+	Group       bool          `json:"group,omitempty"`
+	GroupLevel  int           `json:"group_level,omitempty"`
+}
+
+// ViewMultiQuery runs several queries on a view in a single request, and
+// returns the result of each query in the order of queries.
+func (ddoc *DesignDocument) ViewMultiQuery(db *DB, view string, queries []ViewOptions) ([]ViewResp, error) {
+	path := "/" + ddoc.ID + "/_view/" + view + "/queries"
+	var data struct {
+		Results []ViewResp `json:"results"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + path).
+		Send(map[string]interface{}{"queries": queries})
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	return data.Results, nil
+}
+
+// ViewReduceCounts returns the numeric values of a reduce view, such as one
+// using _count or _sum, grouped by key. A groupLevel of zero groups by
+// exact key. Keys that aren't strings are given in their JSON form, and an
+// error is returned if a value isn't a number.
+func (ddoc *DesignDocument) ViewReduceCounts(db *DB, view string, groupLevel int) (map[string]float64, error) {
+	path := "/" + ddoc.ID + "/_view/" + view
+	var data struct {
+		Rows []struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"rows"`
+	}
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Get(db.path + path)
+	if groupLevel > 0 {
+		req.Param("group_level", strconv.Itoa(groupLevel))
+	} else {
+		req.Param("group", "true")
+	}
+	if err := db.client.end(req, &data); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]float64, len(data.Rows))
+	for _, row := range data.Rows {
+		key := string(row.Key)
+		json.Unmarshal(row.Key, &key)
+		var value float64
+		if err := json.Unmarshal(row.Value, &value); err != nil {
+			return nil, errors.New("Non-numeric value for key " + key + ": " + string(row.Value))
+		}
+		counts[key] = value
+	}
+	return counts, nil
+}
+
+// ExportViewCSV writes the rows of a view as CSV to w, with a header line
+// naming the columns. Each column is looked up in the document of the row
+// with opts.IncludeDocs, or else in its value, as a field name or a dot
+// separated path; "id", "key" and "value" otherwise refer to the row
+// itself. Strings are written as is, other values in their JSON form. Rows
+// are streamed, so views of any size can be exported.
+func (ddoc *DesignDocument) ExportViewCSV(db *DB, view string, columns []string, w io.Writer, opts ViewOptions) error {
+	path := "/" + ddoc.ID + "/_view/" + view
+	req := request.New().
+		SetBasicAuth(db.username, db.password).
+		Post(db.path + path).
+		Send(opts)
+	resp, err := db.client.stream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	d := json.NewDecoder(resp.Body)
+	d.UseNumber()
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if tok == "rows" {
+			break
+		}
+	}
+	if _, err := d.Token(); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for d.More() {
+		var row struct {
+			ID    string      `json:"id"`
+			Key   interface{} `json:"key"`
+			Value interface{} `json:"value"`
+			Doc   interface{} `json:"doc"`
+		}
+		if err := d.Decode(&row); err != nil {
+			return err
+		}
+		fields := row.Doc
+		if fields == nil {
+			fields = row.Value
+		}
+		self := map[string]interface{}{"id": row.ID, "key": row.Key, "value": row.Value}
+		for i, column := range columns {
+			v, ok := lookupPath(fields, column)
+			if !ok {
+				v = self[column]
+			}
+			if record[i], err = csvCell(v); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// lookupPath returns the value at a dot separated path of fields.
+func lookupPath(fields interface{}, path string) (interface{}, bool) {
+	v := fields
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// csvCell formats a JSON value as a CSV cell.
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
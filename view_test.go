@@ -0,0 +1,24 @@
+package cloudant
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVCell(t *testing.T) {
+	t.Log("Testing CSV export cells")
+	var fields interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"a","owner":{"age":3},"tags":["x"],"none":null}`), &fields))
+
+	for path, want := range map[string]string{"name": "a", "owner.age": "3", "tags": `["x"]`, "none": ""} {
+		v, ok := lookupPath(fields, path)
+		assert.True(t, ok, path)
+		cell, err := csvCell(v)
+		assert.NoError(t, err)
+		assert.Equal(t, want, cell, path)
+	}
+	_, ok := lookupPath(fields, "owner.missing")
+	assert.False(t, ok)
+}